@@ -26,12 +26,17 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"anongit.kde.org/websites/api-projects-kde-org.git/apis"
+
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
 var router *gin.Engine
 
+// subresources are shared by the project and dependency resources of /v1.
+var subresources = apis.NewProjectSubresources()
+
 func init() {
 	router = gin.Default()
 }
@@ -53,6 +58,26 @@ func testAPI(method, URL, body string) *httptest.ResponseRecorder {
 	return res
 }
 
+func testAPIWithAccept(method, URL, accept string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, URL, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func testAPIWithToken(method, URL, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, URL, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
 func runAPITests(t *testing.T, tests []apiTestCase) {
 	// go 1.8+ would have t.Run(), alas, 16.04 has 1.6 by default.
 	for _, test := range tests {
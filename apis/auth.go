@@ -0,0 +1,88 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const tokenKey = "token"
+
+type authService interface {
+	Authenticate(secret string) (models.Token, error)
+}
+
+// Authenticate returns a middleware resolving the bearer token of a
+// request. Requests without Authorization header stay anonymous, requests
+// with an unknown token are rejected and the rejection is not to be cached.
+func Authenticate(service authService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			c.Next()
+			return
+		}
+		if !strings.HasPrefix(header, "Bearer ") {
+			c.Header("Cache-Control", "no-store")
+			c.Header("WWW-Authenticate", `Bearer`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "expected bearer token"})
+			return
+		}
+		token, err := service.Authenticate(strings.TrimPrefix(header, "Bearer "))
+		if err != nil {
+			c.Header("Cache-Control", "no-store")
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(tokenKey, token)
+		c.Next()
+	}
+}
+
+// RequireScope returns a middleware rejecting requests whose token does not
+// grant scope. It relies on Authenticate running before it. Responses are
+// kept out of caches.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(scopedKey, true)
+		cacheControl(c)
+		value, ok := c.Get(tokenKey)
+		if !ok {
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer scope="%s"`, scope))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token required"})
+			return
+		}
+		token := value.(models.Token)
+		if !token.HasScope(scope) {
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "token lacks scope " + scope})
+			return
+		}
+		c.Next()
+	}
+}
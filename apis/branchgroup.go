@@ -0,0 +1,126 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"context"
+	"net/http"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type branchGroupService interface {
+	Branch(ctx context.Context, group string, path models.ProjectPath) (string, error)
+	Branches(ctx context.Context, group string) (map[models.ProjectPath]string, error)
+}
+
+type branchGroupResource struct {
+	service branchGroupService
+}
+
+func ServeBranchGroupResource(rg *gin.RouterGroup, service branchGroupService) {
+	r := &branchGroupResource{service}
+	rg.GET("/branchgroup/:group", r.branches)
+	rg.GET("/branchgroup/:group/*path", r.branch)
+}
+
+func branchGroupError(c *gin.Context, err error) {
+	switch err {
+	case models.ErrNotFound, models.ErrUnknownBranchGroup, models.ErrNoBranch:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case models.ErrBranchGroupsUnavailable:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	panic(err)
+}
+
+/**
+ * @api {get} /branchgroup/:group Branches
+ *
+ * @apiVersion 1.0.0
+ * @apiGroup Dependencies
+ * @apiName branchgroup
+ *
+ * @apiDescription Resolves the git branch of every project in the branch
+ *   group (e.g. <code>kf5-qt5</code>) according to the
+ *   logical-module-structure of kde-build-metadata. Projects without branch in
+ *   the group are left out.
+ *
+ * @apiSuccessExample {json} Success-Response:
+ *   {
+ *   "calligra/krita": "master",
+ *   "frameworks/solid": "master",
+ *   ...
+ *   }
+ *
+ * @apiError NotFound Unknown branch group.
+ * @apiError ServiceUnavailable No logical-module-structure in
+ *   kde-build-metadata.
+ */
+func (r *branchGroupResource) branches(c *gin.Context) {
+	branches, err := r.service.Branches(c.Request.Context(), c.Param("group"))
+	if err != nil {
+		branchGroupError(c, err)
+		return
+	}
+	render(c, http.StatusOK, branches)
+}
+
+/**
+ * @api {get} /branchgroup/:group/:path Branch
+ *
+ * @apiVersion 1.0.0
+ * @apiGroup Dependencies
+ * @apiName branchgroupProject
+ *
+ * @apiDescription Resolves the git branch of the project identified by
+ *   <code>path</code> in the branch group.
+ *
+ * @apiSuccessExample {json} Success-Response:
+ *   "master"
+ *
+ * @apiError Forbidden Path may not be accessed.
+ * @apiError NotFound Unknown project or branch group, or no branch for the
+ *   project in the group.
+ * @apiError ServiceUnavailable No logical-module-structure in
+ *   kde-build-metadata.
+ */
+func (r *branchGroupResource) branch(c *gin.Context) {
+	if c.Param("path") == "/" {
+		r.branches(c)
+		return
+	}
+	path, err := models.ParseProjectPath(c.Param("path"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	branch, err := r.service.Branch(c.Request.Context(), c.Param("group"), path)
+	if err != nil {
+		branchGroupError(c, err)
+		return
+	}
+	render(c, http.StatusOK, branch)
+}
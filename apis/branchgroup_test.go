@@ -0,0 +1,72 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/apis"
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+)
+
+// Test Double
+type BranchGroupService struct {
+}
+
+func (s *BranchGroupService) Branch(ctx context.Context, group string, path models.ProjectPath) (string, error) {
+	if group != "kf5-qt5" {
+		return "", models.ErrUnknownBranchGroup
+	}
+	if path == "calligra/krita" {
+		return "master", nil
+	}
+	return "", models.ErrNoBranch
+}
+
+func (s *BranchGroupService) Branches(ctx context.Context, group string) (map[models.ProjectPath]string, error) {
+	if group == "unavailable" {
+		return nil, models.ErrBranchGroupsUnavailable
+	}
+	if group != "kf5-qt5" {
+		return nil, models.ErrUnknownBranchGroup
+	}
+	return map[models.ProjectPath]string{"calligra/krita": "master"}, nil
+}
+
+func init() {
+	v1 := router.Group("/v1")
+	{
+		apis.ServeBranchGroupResource(v1, &BranchGroupService{})
+	}
+}
+
+func TestBranchGroup(t *testing.T) {
+	runAPITests(t, []apiTestCase{
+		{"t1 - all", "GET", "/v1/branchgroup/kf5-qt5", "", http.StatusOK, `{"calligra/krita": "master"}`},
+		{"t2 - all with slash", "GET", "/v1/branchgroup/kf5-qt5/", "", http.StatusOK, `{"calligra/krita": "master"}`},
+		{"t3 - one", "GET", "/v1/branchgroup/kf5-qt5/calligra/krita", "", http.StatusOK, `"master"`},
+		{"t4 - no branch", "GET", "/v1/branchgroup/kf5-qt5/frameworks/solid", "", http.StatusNotFound, `{"error": "no branch in branch group"}`},
+		{"t5 - unknown group", "GET", "/v1/branchgroup/kf6", "", http.StatusNotFound, `{"error": "unknown branch group"}`},
+		{"t6 - unavailable", "GET", "/v1/branchgroup/unavailable", "", http.StatusServiceUnavailable, `{"error": "branch groups unavailable"}`},
+	})
+}
@@ -0,0 +1,137 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	revisionKey     = "revision"
+	lastModifiedKey = "lastModified"
+	maxAgeKey       = "maxAge"
+	scopedKey       = "scoped"
+)
+
+type revisionService interface {
+	Revision() string
+	LastModified() time.Time
+}
+
+// CacheHeaders returns a middleware adding revision and cache metadata to
+// every response. Clients may cache for maxAge, which should be the
+// interval in which the served revision can change. Shared caches only get
+// to keep responses that do not depend on a token, see cacheControl.
+func CacheHeaders(service revisionService, maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		revision := service.Revision()
+		c.Set(revisionKey, revision)
+		c.Header("X-Metadata-Revision", revision)
+		if modified := service.LastModified(); !modified.IsZero() {
+			c.Set(lastModifiedKey, modified)
+			c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		}
+		c.Set(maxAgeKey, maxAge)
+		c.Writer.Header().Add("Vary", "Authorization")
+		cacheControl(c)
+		c.Next()
+	}
+}
+
+// cacheControl sets Cache-Control according to what is known about the
+// request so far. Responses of routes requiring a scope are not to be
+// stored at all, those to requests with a token only by the client.
+func cacheControl(c *gin.Context) {
+	maxAge := int(c.GetDuration(maxAgeKey).Seconds())
+	switch {
+	case c.GetBool(scopedKey):
+		c.Header("Cache-Control", "no-store")
+	case c.GetHeader("Authorization") != "":
+		c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", maxAge))
+	default:
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+	}
+}
+
+// setRevision replaces the revision CacheHeaders announced with the one the
+// data of the response was read at. An update may land in between.
+func setRevision(c *gin.Context, revision string) {
+	c.Set(revisionKey, revision)
+	c.Header("X-Metadata-Revision", revision)
+}
+
+// etag derives a strong entity tag from the body and the revision it was
+// generated from.
+func etag(revision string, body []byte) string {
+	hash := sha1.New()
+	hash.Write([]byte(revision))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	return `"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+}
+
+func etagMatches(header string, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified implements the precondition checks of RFC 7232. If-None-Match
+// takes precedence, If-Modified-Since is only looked at without it.
+func notModified(c *gin.Context, tag string) bool {
+	if header := c.GetHeader("If-None-Match"); header != "" {
+		return etagMatches(header, tag)
+	}
+	value, ok := c.Get(lastModifiedKey)
+	if !ok {
+		return false
+	}
+	since, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !value.(time.Time).Truncate(time.Second).After(since)
+}
+
+// cachedData writes body with an ETag. Requests whose preconditions say
+// the client already has this representation get a 304 Not Modified
+// without body.
+func cachedData(c *gin.Context, code int, contentType string, body []byte) {
+	tag := etag(c.GetString(revisionKey), body)
+	c.Header("ETag", tag)
+	safe := c.Request.Method == "GET" || c.Request.Method == "HEAD"
+	if safe && code == http.StatusOK && notModified(c, tag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(code, contentType, body)
+}
@@ -0,0 +1,148 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/apis"
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test Double
+type RevisionService struct {
+}
+
+func (s *RevisionService) Revision() string {
+	return "abc123"
+}
+
+func (s *RevisionService) LastModified() time.Time {
+	return time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+}
+
+func init() {
+	cached := router.Group("/cached")
+	{
+		// In the order of serve.
+		cached.Use(apis.CacheHeaders(&RevisionService{}, 4*time.Minute), apis.Authenticate(NewAuthService()),
+			apis.RateLimiter(apis.RateLimit{Interval: time.Hour, Burst: 100}))
+		apis.ServeProjectResource(cached, NewProjectService(), nil)
+		cached.GET("/scoped", apis.RequireScope(models.ScopeRead), func(c *gin.Context) {
+			c.JSON(http.StatusOK, "secret")
+		})
+		limited := cached.Group("/limited", apis.RateLimiter(apis.RateLimit{Interval: time.Hour, Burst: 1}))
+		limited.GET("", func(c *gin.Context) { c.JSON(http.StatusOK, "pong") })
+	}
+	// Like serve --private.
+	private := router.Group("/private-cached", apis.CacheHeaders(&RevisionService{}, 4*time.Minute),
+		apis.Authenticate(NewAuthService()), apis.RequireScope(models.ScopeRead))
+	{
+		apis.ServeProjectResource(private, NewProjectService(), nil)
+	}
+}
+
+func testCachedAPI(header string, value string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/cached/project/calligra/krita", nil)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestCacheHeaders(t *testing.T) {
+	res := testCachedAPI("", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, dataRevision, res.Header().Get("X-Metadata-Revision"), "revision of the data")
+	assert.Equal(t, "Thu, 01 Jun 2017 12:00:00 GMT", res.Header().Get("Last-Modified"))
+	assert.Equal(t, "public, max-age=240", res.Header().Get("Cache-Control"))
+	assert.Equal(t, []string{"Authorization", "Accept"}, res.Header().Values("Vary"))
+	tag := res.Header().Get("ETag")
+	assert.NotEmpty(t, tag)
+
+	res = testCachedAPI("If-None-Match", tag)
+	assert.Equal(t, http.StatusNotModified, res.Code, "matching etag")
+	assert.Empty(t, res.Body.String())
+
+	res = testCachedAPI("If-None-Match", `"other", W/`+tag)
+	assert.Equal(t, http.StatusNotModified, res.Code, "weak etag in list")
+
+	res = testCachedAPI("If-None-Match", `"other"`)
+	assert.Equal(t, http.StatusOK, res.Code, "mismatching etag")
+
+	res = testCachedAPI("If-Modified-Since", "Thu, 01 Jun 2017 12:00:00 GMT")
+	assert.Equal(t, http.StatusNotModified, res.Code, "not modified since")
+
+	res = testCachedAPI("If-Modified-Since", "Thu, 01 Jun 2017 11:59:59 GMT")
+	assert.Equal(t, http.StatusOK, res.Code, "modified since")
+
+	req, _ := http.NewRequest("POST", "/cached/projects", strings.NewReader(`["krita"]`))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, dataRevision, res.Header().Get("X-Metadata-Revision"), "revision of a batch")
+}
+
+func TestCacheHeadersWithToken(t *testing.T) {
+	res := testAPIWithToken("GET", "/cached/project/calligra/krita", "reader")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "private, max-age=240", res.Header().Get("Cache-Control"))
+	assert.Contains(t, res.Header().Values("Vary"), "Authorization")
+
+	res = testAPIWithToken("GET", "/cached/scoped", "reader")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+	res = testAPIWithToken("GET", "/cached/scoped", "")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+
+	res = testAPIWithToken("GET", "/private-cached/project/calligra/krita", "reader")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+	assert.Contains(t, res.Header().Values("Vary"), "Authorization")
+}
+
+func TestCacheHeadersOfRejections(t *testing.T) {
+	res := testAPIWithToken("GET", "/cached/project/calligra/krita", "nope")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Equal(t, "abc123", res.Header().Get("X-Metadata-Revision"))
+	assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+
+	res = testAPIWithToken("GET", "/private-cached/project/calligra/krita", "")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Equal(t, "abc123", res.Header().Get("X-Metadata-Revision"))
+	assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+
+	res = testAPIWithToken("GET", "/cached/limited", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	res = testAPIWithToken("GET", "/cached/limited", "")
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.Equal(t, "abc123", res.Header().Get("X-Metadata-Revision"))
+	assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+}
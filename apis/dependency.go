@@ -0,0 +1,174 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultBranchGroup = "kf5-qt5"
+
+type dependencyService interface {
+	Dependencies(ctx context.Context, branchGroup string, path models.ProjectPath) ([]models.ProjectPath, error)
+	Dependents(ctx context.Context, branchGroup string, path models.ProjectPath) ([]models.ProjectPath, error)
+	BuildOrder(ctx context.Context, branchGroup string, paths []models.ProjectPath) ([]models.ProjectPath, error)
+}
+
+type dependencyResource struct {
+	service dependencyService
+}
+
+// ServeDependencyResource serves dependency data. The dependencies and
+// dependents of a project are added to subresources.
+func ServeDependencyResource(rg *gin.RouterGroup, subresources *ProjectSubresources, service dependencyService) {
+	r := &dependencyResource{service}
+	subresources.serve(rg, "dependencies", r.dependencies)
+	subresources.serve(rg, "dependents", r.dependents)
+	rg.GET("/buildorder", r.buildOrder)
+}
+
+func dependencyError(c *gin.Context, err error) {
+	switch err.(type) {
+	case *models.CycleError:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	switch err {
+	case models.ErrNotFound, models.ErrUnknownBranchGroup:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	panic(err)
+}
+
+/**
+ * @api {get} /project/:path/dependencies Dependencies
+ * @apiParam {String} [branchgroup=kf5-qt5] Branch group of the dependency
+ *   data.
+ *
+ * @apiVersion 1.0.0
+ * @apiGroup Dependencies
+ * @apiName dependencies
+ *
+ * @apiDescription Lists the direct dependencies of the project identified by
+ *   <code>path</code> according to kde-build-metadata.
+ *
+ * @apiSuccessExample {json} Success-Response:
+ *   [
+ *   "frameworks/extra-cmake-modules",
+ *   "frameworks/solid"
+ *   ]
+ *
+ * @apiError NotFound Unknown project or branch group.
+ */
+func (r *dependencyResource) dependencies(c *gin.Context, path models.ProjectPath) {
+	deps, err := r.service.Dependencies(c.Request.Context(), c.DefaultQuery("branchgroup", defaultBranchGroup), path)
+	if err != nil {
+		dependencyError(c, err)
+		return
+	}
+	render(c, http.StatusOK, deps)
+}
+
+/**
+ * @api {get} /project/:path/dependents Dependents
+ * @apiParam {String} [branchgroup=kf5-qt5] Branch group of the dependency
+ *   data.
+ *
+ * @apiVersion 1.0.0
+ * @apiGroup Dependencies
+ * @apiName dependents
+ *
+ * @apiDescription Lists the projects directly depending on the project
+ *   identified by <code>path</code> according to kde-build-metadata.
+ *
+ * @apiSuccessExample {json} Success-Response:
+ *   [
+ *   "frameworks/kio",
+ *   "kde/workspace/plasma-workspace"
+ *   ]
+ *
+ * @apiError NotFound Unknown project or branch group.
+ */
+func (r *dependencyResource) dependents(c *gin.Context, path models.ProjectPath) {
+	deps, err := r.service.Dependents(c.Request.Context(), c.DefaultQuery("branchgroup", defaultBranchGroup), path)
+	if err != nil {
+		dependencyError(c, err)
+		return
+	}
+	render(c, http.StatusOK, deps)
+}
+
+/**
+ * @api {get} /buildorder Build Order
+ * @apiParam {String[]} project Project paths to build. May be repeated or
+ *   comma separated.
+ * @apiParam {String} [branchgroup=kf5-qt5] Branch group of the dependency
+ *   data.
+ *
+ * @apiVersion 1.0.0
+ * @apiGroup Dependencies
+ * @apiName buildorder
+ *
+ * @apiDescription Orders the projects and all their dependencies so every
+ *   project comes after the projects it depends on.
+ *
+ * @apiSuccessExample {json} Success-Response:
+ *   [
+ *   "frameworks/extra-cmake-modules",
+ *   "frameworks/solid",
+ *   "frameworks/kio"
+ *   ]
+ *
+ * @apiError BadRequest No or invalid projects.
+ * @apiError NotFound Unknown project or branch group.
+ * @apiError Conflict The dependencies form a cycle.
+ */
+func (r *dependencyResource) buildOrder(c *gin.Context) {
+	paths := []models.ProjectPath{}
+	for _, param := range c.QueryArray("project") {
+		for _, str := range strings.Split(param, ",") {
+			path, err := models.ParseProjectPath(str)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no project"})
+		return
+	}
+
+	order, err := r.service.BuildOrder(c.Request.Context(), c.DefaultQuery("branchgroup", defaultBranchGroup), paths)
+	if err != nil {
+		dependencyError(c, err)
+		return
+	}
+	render(c, http.StatusOK, order)
+}
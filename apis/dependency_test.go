@@ -0,0 +1,78 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/apis"
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+)
+
+// Test Double
+type DependencyService struct {
+}
+
+func (s *DependencyService) Dependencies(ctx context.Context, branchGroup string, path models.ProjectPath) ([]models.ProjectPath, error) {
+	if branchGroup != "kf5-qt5" {
+		return nil, models.ErrUnknownBranchGroup
+	}
+	if path == "calligra/krita" {
+		return []models.ProjectPath{"frameworks/solid"}, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+func (s *DependencyService) Dependents(ctx context.Context, branchGroup string, path models.ProjectPath) ([]models.ProjectPath, error) {
+	if path == "frameworks/solid" {
+		return []models.ProjectPath{"calligra/krita"}, nil
+	}
+	return nil, models.ErrNotFound
+}
+
+func (s *DependencyService) BuildOrder(ctx context.Context, branchGroup string, paths []models.ProjectPath) ([]models.ProjectPath, error) {
+	if len(paths) == 2 {
+		return nil, &models.CycleError{Cycle: []models.ProjectPath{"a", "b", "a"}}
+	}
+	return []models.ProjectPath{"frameworks/solid", paths[0]}, nil
+}
+
+func init() {
+	v1 := router.Group("/v1")
+	{
+		apis.ServeDependencyResource(v1, subresources, &DependencyService{})
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	runAPITests(t, []apiTestCase{
+		{"t1 - dependencies", "GET", "/v1/project/calligra/krita/dependencies", "", http.StatusOK, `["frameworks/solid"]`},
+		{"t2 - dependents", "GET", "/v1/project/frameworks/solid/dependents", "", http.StatusOK, `["calligra/krita"]`},
+		{"t3 - unknown branch group", "GET", "/v1/project/calligra/krita/dependencies?branchgroup=kf6", "", http.StatusNotFound, `{"error": "unknown branch group"}`},
+		{"t4 - unknown project", "GET", "/v1/project/nope/dependencies", "", http.StatusNotFound, `{"error": "project not found"}`},
+		{"t5 - project still works", "GET", "/v1/project/calligra/krita", "", http.StatusOK, `{"repopath":"krita"}`},
+		{"t6 - build order", "GET", "/v1/buildorder?project=calligra/krita", "", http.StatusOK, `["frameworks/solid", "calligra/krita"]`},
+		{"t7 - build order cycle", "GET", "/v1/buildorder?project=a,b", "", http.StatusConflict, `{"error": "dependency cycle: a -> b -> a"}`},
+		{"t8 - build order without projects", "GET", "/v1/buildorder", "", http.StatusBadRequest, `{"error": "no project"}`},
+	})
+}
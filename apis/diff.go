@@ -0,0 +1,117 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Without a token diffs are to the served revision, from one of the last
+// diffAnonymousMaxRevisions revisions. There are few such diffs per revision
+// and they stay cached.
+const diffAnonymousMaxRevisions = 20
+
+type diffService interface {
+	Diff(ctx context.Context, from string, to string, within int) (*models.Diff, error)
+}
+
+type diffResource struct {
+	service diffService
+}
+
+func ServeDiffResource(rg *gin.RouterGroup, service diffService) {
+	r := &diffResource{service}
+	rg.GET("/diff", r.diff)
+}
+
+/**
+ * @api {get} /diff Diff
+ * @apiParam {String} from Revision to compare from. Without a token one of
+ *   the 20 revisions before <code>to</code>.
+ * @apiParam {String} [to] Revision to compare to. Defaults to the served
+ *   revision, which it has to be without a token.
+ *
+ * @apiVersion 1.0.0
+ * @apiGroup Project
+ * @apiName diff
+ *
+ * @apiDescription Compares the resolved metadata of two repo-metadata
+ *   revisions. Changes to values cascaded from defaults, such as i18n
+ *   branches from <code>i18n_defaults.json</code>, are included. Projects
+ *   changing path but keeping their <code>repopath</code> are listed as
+ *   moved.
+ *
+ * @apiSuccessExample {json} Success-Response:
+ *   {
+ *   "from": "5f1c...",
+ *   "to": "9a3e...",
+ *   "added": ["frameworks/kirigami"],
+ *   "removed": [],
+ *   "moved": [
+ *     { "from": "extragear/graphics/krita", "to": "calligra/krita", "repopath": "krita" }
+ *   ],
+ *   "modified": {
+ *     "frameworks/solid": [
+ *       { "field": "i18n.stable_kf5", "old": "none", "new": "Applications/17.04" }
+ *     ]
+ *   }
+ *   }
+ *
+ * @apiError BadRequest No from revision, or without a token a to
+ *   revision or a from revision out of range.
+ * @apiError NotFound Unknown revision.
+ */
+func (r *diffResource) diff(c *gin.Context) {
+	from := c.Query("from")
+	if from == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing from revision"})
+		return
+	}
+	to, within := c.Query("to"), 0
+	if _, ok := c.Get(tokenKey); !ok {
+		if to != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to requires a token"})
+			return
+		}
+		within = diffAnonymousMaxRevisions
+	}
+	diff, err := r.service.Diff(c.Request.Context(), from, to, within)
+	if err == models.ErrUnknownRevision {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err == models.ErrRevisionOutOfRange {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("from must be one of the last %d revisions without a token", diffAnonymousMaxRevisions),
+		})
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	render(c, http.StatusOK, diff)
+}
@@ -0,0 +1,87 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/apis"
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test Double
+type DiffService struct {
+}
+
+func (s *DiffService) Diff(ctx context.Context, from string, to string, within int) (*models.Diff, error) {
+	if from == "old" && within > 0 {
+		return nil, models.ErrRevisionOutOfRange
+	}
+	if from != "abc" && from != "old" {
+		return nil, models.ErrUnknownRevision
+	}
+	if to == "" {
+		to = "def"
+	}
+	return &models.Diff{
+		From:    from,
+		To:      to,
+		Added:   []models.ProjectPath{"frameworks/kirigami"},
+		Removed: []models.ProjectPath{},
+		Moved: []models.Move{
+			{From: "extragear/graphics/krita", To: "calligra/krita", Repopath: "krita"},
+		},
+		Modified: map[models.ProjectPath][]models.FieldChange{
+			"frameworks/solid": {{Field: "i18n.stable_kf5", Old: "none", New: "Applications/17.04"}},
+		},
+	}, nil
+}
+
+func init() {
+	v1 := router.Group("/v1", apis.Authenticate(NewAuthService()))
+	{
+		apis.ServeDiffResource(v1, &DiffService{})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	runAPITests(t, []apiTestCase{
+		{"t1 - diff", "GET", "/v1/diff?from=abc", "", http.StatusOK, `{
+			"from": "abc", "to": "def",
+			"added": ["frameworks/kirigami"], "removed": [],
+			"moved": [{"from": "extragear/graphics/krita", "to": "calligra/krita", "repopath": "krita"}],
+			"modified": {"frameworks/solid": [{"field": "i18n.stable_kf5", "old": "none", "new": "Applications/17.04"}]}
+		}`},
+		{"t2 - unknown revision", "GET", "/v1/diff?from=nope", "", http.StatusNotFound, `{"error": "unknown revision"}`},
+		{"t3 - missing from", "GET", "/v1/diff", "", http.StatusBadRequest, `{"error": "missing from revision"}`},
+		{"t4 - old from", "GET", "/v1/diff?from=old", "", http.StatusBadRequest,
+			`{"error": "from must be one of the last 20 revisions without a token"}`},
+		{"t5 - to", "GET", "/v1/diff?from=abc&to=ghi", "", http.StatusBadRequest, `{"error": "to requires a token"}`},
+	})
+
+	res := testAPIWithToken("GET", "/v1/diff?from=old&to=ghi", "reader")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Contains(t, res.Body.String(), `"to":"ghi"`)
+}
@@ -0,0 +1,207 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	mimeJSON   = "application/json"
+	mimeYAML   = "application/x-yaml"
+	mimeCSV    = "text/csv"
+	mimeNDJSON = "application/x-ndjson"
+)
+
+// Values of the ?format= override mapped to their content type.
+var formats = map[string]string{
+	"json":   mimeJSON,
+	"yaml":   mimeYAML,
+	"csv":    mimeCSV,
+	"ndjson": mimeNDJSON,
+}
+
+// negotiateFormat picks the content type of the response. ?format= wins over
+// the Accept header. An empty return value means nothing acceptable is on
+// offer.
+func negotiateFormat(c *gin.Context) string {
+	if format := c.Query("format"); format != "" {
+		return formats[format]
+	}
+	switch c.NegotiateFormat(mimeJSON, mimeYAML, "application/yaml", "text/yaml",
+		mimeCSV, mimeNDJSON) {
+	case mimeJSON:
+		return mimeJSON
+	case mimeYAML, "application/yaml", "text/yaml":
+		return mimeYAML
+	case mimeCSV:
+		return mimeCSV
+	case mimeNDJSON:
+		return mimeNDJSON
+	}
+	return ""
+}
+
+// rows breaks obj into the records of line based formats. Single projects
+// are one record, lists are one record per entry and plain strings are
+// presented as records with only a path.
+func rows(obj interface{}) ([]interface{}, bool) {
+	switch x := obj.(type) {
+	case models.Project:
+		return []interface{}{x}, true
+	case []models.Project:
+		ret := make([]interface{}, len(x))
+		for i, project := range x {
+			ret[i] = project
+		}
+		return ret, true
+	case []models.ProjectPath:
+		ret := make([]interface{}, len(x))
+		for i, path := range x {
+			ret[i] = map[string]interface{}{"path": path.String()}
+		}
+		return ret, true
+	}
+	return nil, false
+}
+
+// flatten collapses nested maps into one level with dotted keys, e.g.
+// i18n.trunk_kf5. Lists are kept as JSON strings.
+func flatten(prefix string, obj interface{}, into map[string]string) {
+	switch x := obj.(type) {
+	case map[string]interface{}:
+		for k, v := range x {
+			flatten(prefix+k+".", v, into)
+		}
+		return
+	case models.Project:
+		flatten(prefix, map[string]interface{}(x), into)
+		return
+	}
+	key := strings.TrimSuffix(prefix, ".")
+	switch x := obj.(type) {
+	case nil:
+		into[key] = ""
+	case string:
+		into[key] = x
+	default:
+		data, _ := json.Marshal(x)
+		into[key] = string(data)
+	}
+}
+
+func renderCSV(records []interface{}, columns []string) ([]byte, error) {
+	flat := make([]map[string]string, len(records))
+	for i, record := range records {
+		flat[i] = map[string]string{}
+		flatten("", record, flat[i])
+	}
+	if len(columns) == 0 {
+		seen := map[string]bool{}
+		for _, record := range flat {
+			for k := range record {
+				if !seen[k] {
+					seen[k] = true
+					columns = append(columns, k)
+				}
+			}
+		}
+		sort.Strings(columns)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(columns)
+	for _, record := range flat {
+		line := make([]string, len(columns))
+		for i, column := range columns {
+			line[i] = record[column]
+		}
+		w.Write(line)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// streamNDJSON writes one JSON document per line, flushing as it goes so
+// large lists do not need to be buffered.
+func streamNDJSON(c *gin.Context, code int, records []interface{}) {
+	c.Header("Content-Type", mimeNDJSON)
+	c.Status(code)
+	encoder := json.NewEncoder(c.Writer)
+	for i, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return
+		}
+		if i%100 == 99 {
+			c.Writer.Flush()
+		}
+	}
+}
+
+// render writes obj in the negotiated format. Everything but NDJSON is
+// buffered and goes through the conditional request handling of cachedData.
+func render(c *gin.Context, code int, obj interface{}) {
+	c.Writer.Header().Add("Vary", "Accept")
+	format := negotiateFormat(c)
+
+	var body []byte
+	var err error
+	switch format {
+	case mimeJSON:
+		body, err = json.Marshal(obj)
+	case mimeYAML:
+		body, err = yaml.Marshal(obj)
+	case mimeCSV, mimeNDJSON:
+		records, ok := rows(obj)
+		if !ok {
+			c.AbortWithStatus(http.StatusNotAcceptable)
+			return
+		}
+		if format == mimeNDJSON {
+			streamNDJSON(c, code, records)
+			return
+		}
+		var columns []string
+		if query := c.Query("columns"); query != "" {
+			columns = strings.Split(query, ",")
+		}
+		body, err = renderCSV(records, columns)
+	default:
+		c.AbortWithStatus(http.StatusNotAcceptable)
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	cachedData(c, code, format+"; charset=utf-8", body)
+}
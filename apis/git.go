@@ -21,48 +21,113 @@
 package apis
 
 import (
-	"fmt"
+	"context"
 	"net/http"
-	"time"
+	"path"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
 
 	"github.com/gin-gonic/gin"
 )
 
 type gitService interface {
-	UpdateClone() string
-	Age() time.Duration
+	Poll(ctx context.Context) models.PollJob
+	PollJob(id string) (models.PollJob, error)
 }
 
 type gitResource struct {
 	service gitService
 }
 
-func ServeGitResource(rg *gin.RouterGroup, service gitService) {
+// ServeGitResource serves poll. The handlers in enqueue run before a job is
+// queued, e.g. a stricter rate limit than for looking at jobs.
+func ServeGitResource(rg *gin.RouterGroup, service gitService, enqueue ...gin.HandlerFunc) {
 	r := &gitResource{service}
-	rg.GET("/poll", r.poll)
+	handlers := append([]gin.HandlerFunc{RequireScope(models.ScopePoll)}, enqueue...)
+	rg.POST("/poll", append(handlers, r.poll)...)
+	rg.GET("/poll/:id", RequireScope(models.ScopePoll), r.job)
 }
 
 /**
- * @api {get} /poll Update Clone
+ * @api {post} /poll Update Clone
+ * @apiHeader {String} Authorization <code>Bearer</code> token with the
+ *   <code>poll</code> scope.
  *
  * @apiVersion 1.0.0
  * @apiGroup Project
  * @apiName poll
  *
- * @apiDescription Updates internal repo-metadata clone. Generally not necessary
- *   to call as the clone is updated automatically. This endpoint is handy when
- *   forcing an update is called for. This is subject to rate limiting.
+ * @apiDescription Queues an update of the internal repo-metadata clone.
+ *   Generally not necessary to call as the clone is updated automatically.
+ *   This endpoint is handy when forcing an update is called for. Polls while
+ *   an update is queued join it. The job can be followed at the
+ *   <code>Location</code>. This is subject to a stricter rate limit than
+ *   other endpoints.
+ *
+ * @apiSuccess (Accepted 202) {String} id Job identifier.
+ * @apiSuccess (Accepted 202) {String} state One of queued, running,
+ *   succeeded or failed.
  *
  * @apiSuccessExample {json} Success-Response:
- *   "Alread up-to-date."
- * @apiError {json} TooManyRequests Already up to date enough.
+ *   HTTP/1.1 202 Accepted
+ *   Location: /v1/poll/5f0c3a4e9b1d2c77
+ *   {
+ *     "id": "5f0c3a4e9b1d2c77",
+ *     "state": "queued",
+ *     "old_revision": "",
+ *     "new_revision": "",
+ *     "changed_projects": 0,
+ *     "output": "",
+ *     "queued_at": "2017-09-12T10:31:02Z",
+ *     "started_at": null,
+ *     "finished_at": null
+ *   }
+ * @apiError Unauthorized No or an unknown token.
+ * @apiError Forbidden Token lacks the <code>poll</code> scope.
+ * @apiError {json} TooManyRequests Rate limit exceeded, retry after
+ *   <code>Retry-After</code> seconds.
  */
 func (r *gitResource) poll(c *gin.Context) {
-	since := r.service.Age()
-	if since.Minutes() < 2.0 {
-		c.JSON(http.StatusTooManyRequests,
-			fmt.Sprintf("Not updating. Last update was %s ago.", since))
+	job := r.service.Poll(c.Request.Context())
+	c.Header("Cache-Control", "no-store")
+	c.Header("Location", path.Join(c.FullPath(), job.ID))
+	c.JSON(http.StatusAccepted, job)
+}
+
+/**
+ * @api {get} /poll/:id Update Job
+ * @apiHeader {String} Authorization <code>Bearer</code> token with the
+ *   <code>poll</code> scope.
+ *
+ * @apiVersion 1.0.0
+ * @apiGroup Project
+ * @apiName pollJob
+ *
+ * @apiDescription Reports on an update queued by poll. Finished jobs are
+ *   forgotten eventually.
+ *
+ * @apiSuccessExample {json} Success-Response:
+ *   {
+ *     "id": "5f0c3a4e9b1d2c77",
+ *     "state": "succeeded",
+ *     "old_revision": "0b6c2f1e4a...",
+ *     "new_revision": "9d41e7c3b2...",
+ *     "changed_projects": 3,
+ *     "output": "Updating 0b6c2f1..9d41e7c\nFast-forward\n...",
+ *     "queued_at": "2017-09-12T10:31:02Z",
+ *     "started_at": "2017-09-12T10:31:02Z",
+ *     "finished_at": "2017-09-12T10:31:04Z"
+ *   }
+ * @apiError Unauthorized No or an unknown token.
+ * @apiError Forbidden Token lacks the <code>poll</code> scope.
+ * @apiError NotFound No such job.
+ */
+func (r *gitResource) job(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	job, err := r.service.PollJob(c.Param("id"))
+	if err == models.ErrUnknownJob {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, r.service.UpdateClone())
+	c.JSON(http.StatusOK, job)
 }
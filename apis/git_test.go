@@ -21,34 +21,56 @@
 package apis
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"testing"
-	"time"
 
 	"anongit.kde.org/websites/api-projects-kde-org.git/apis"
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/stretchr/testify/assert"
 )
 
 // Test Double
 type GitService struct {
-	age time.Duration
 }
 
 func NewGitService() *GitService {
-	age, _ := time.ParseDuration("5m")
-	return &GitService{age}
+	return &GitService{}
 }
 
-func (s *GitService) UpdateClone() string {
-	s.age = 0
-	return "UPDATED"
+func (s *GitService) Poll(ctx context.Context) models.PollJob {
+	return models.PollJob{ID: "job", State: models.JobQueued}
 }
 
-func (s *GitService) Age() time.Duration {
-	return s.age
+func (s *GitService) PollJob(id string) (models.PollJob, error) {
+	if id != "job" {
+		return models.PollJob{}, models.ErrUnknownJob
+	}
+	return models.PollJob{ID: "job", State: models.JobSucceeded, OldRevision: "old", NewRevision: "new", ChangedProjects: 2}, nil
+}
+
+// Test Double
+type AuthService struct {
+}
+
+func NewAuthService() *AuthService {
+	return &AuthService{}
+}
+
+func (s *AuthService) Authenticate(secret string) (models.Token, error) {
+	switch secret {
+	case "poller":
+		return models.Token{Name: "poller", Hash: models.HashToken(secret), Scopes: []string{models.ScopePoll}}, nil
+	case "reader":
+		return models.Token{Name: "reader", Hash: models.HashToken(secret), Scopes: []string{models.ScopeRead}}, nil
+	}
+	return models.Token{}, models.ErrInvalidToken
 }
 
 func init() {
-	v1 := router.Group("/v1")
+	v1 := router.Group("/v1", apis.Authenticate(NewAuthService()))
 	{
 		apis.ServeGitResource(v1, NewGitService())
 	}
@@ -56,7 +78,36 @@ func init() {
 
 func TestGit(t *testing.T) {
 	runAPITests(t, []apiTestCase{
-		{"t1 - poll", "GET", "/v1/poll", "", http.StatusOK, `"UPDATED"`},
-		{"t2 - poll", "GET", "/v1/poll", "", http.StatusTooManyRequests, `"Not updating. Last update was 0 ago."`},
+		{"t1 - poll anonymously", "POST", "/v1/poll", "", http.StatusUnauthorized, ""},
 	})
+
+	res := testAPIWithToken("POST", "/v1/poll", "poller")
+	assert.Equal(t, http.StatusAccepted, res.Code)
+	assert.Equal(t, "/v1/poll/job", res.Header().Get("Location"))
+	assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+	var job models.PollJob
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &job))
+	assert.Equal(t, models.PollJob{ID: "job", State: models.JobQueued}, job)
+
+	res = testAPIWithToken("GET", "/v1/poll/job", "poller")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &job))
+	assert.Equal(t, models.JobSucceeded, job.State)
+	assert.Equal(t, 2, job.ChangedProjects)
+
+	res = testAPIWithToken("GET", "/v1/poll/nope", "poller")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	res = testAPIWithToken("GET", "/v1/poll/job", "reader")
+	assert.Equal(t, http.StatusForbidden, res.Code)
+
+	res = testAPIWithToken("POST", "/v1/poll", "reader")
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.Contains(t, res.Header().Get("WWW-Authenticate"), "insufficient_scope")
+
+	res = testAPIWithToken("POST", "/v1/poll", "unknown")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	res = testAPIWithToken("GET", "/v1/poll", "poller")
+	assert.Equal(t, http.StatusNotFound, res.Code)
 }
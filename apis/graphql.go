@@ -0,0 +1,428 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// Limits protecting the server from expensive queries. Depth counts nested
+// selections, complexity counts fields with fields below lists weighted by
+// the page size of the list. Lists return at most graphQLMaxPage projects,
+// what a query does not ask for with first counts as a full page.
+const (
+	graphQLMaxDepth      = 10
+	graphQLMaxComplexity = 5000
+	graphQLMaxPage       = 500
+)
+
+type graphService interface {
+	Get(ctx context.Context, path models.ProjectPath) (models.Project, string, error)
+	Find(ctx context.Context, id string, repopath string) ([]models.ProjectPath, error)
+	Children(ctx context.Context, path models.ProjectPath) ([]models.ProjectPath, error)
+}
+
+type graphResource struct {
+	service graphService
+	schema  graphql.Schema
+}
+
+// graphProject is the source object of the Project type. The path is not
+// part of the metadata so it is carried alongside.
+type graphProject struct {
+	path    models.ProjectPath
+	project models.Project
+}
+
+func ServeGraphQLResource(rg *gin.RouterGroup, service graphService) {
+	r := &graphResource{service: service}
+	schema, err := r.newSchema()
+	if err != nil {
+		panic(err)
+	}
+	r.schema = schema
+	rg.GET("/graphql", r.query)
+	rg.POST("/graphql", r.query)
+}
+
+func (r *graphResource) project(ctx context.Context, projectPath models.ProjectPath) (*graphProject, error) {
+	project, _, err := r.service.Get(ctx, projectPath)
+	if err != nil {
+		return nil, err
+	}
+	return &graphProject{projectPath, project}, nil
+}
+
+func (r *graphResource) projects(ctx context.Context, paths []models.ProjectPath) ([]*graphProject, error) {
+	ret := []*graphProject{}
+	for _, projectPath := range paths {
+		project, err := r.project(ctx, projectPath)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, project)
+	}
+	return ret, nil
+}
+
+// pageArgs are the arguments of list fields, extra ones may be added.
+func pageArgs(extra graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	args := graphql.FieldConfigArgument{
+		"first": &graphql.ArgumentConfig{
+			Type:        graphql.Int,
+			Description: fmt.Sprintf("Number of projects, at most %d.", graphQLMaxPage),
+		},
+		"after": &graphql.ArgumentConfig{
+			Type:        graphql.String,
+			Description: "Path of the last project of the previous page.",
+		},
+	}
+	for name, arg := range extra {
+		args[name] = arg
+	}
+	return args
+}
+
+// paginate cuts paths to the page asked for by the first and after
+// arguments. Pages are in path order.
+func paginate(p graphql.ResolveParams, paths []models.ProjectPath) ([]models.ProjectPath, error) {
+	first := graphQLMaxPage
+	if value, ok := p.Args["first"].(int); ok {
+		if value < 0 || value > graphQLMaxPage {
+			return nil, fmt.Errorf("first must be between 0 and %d", graphQLMaxPage)
+		}
+		first = value
+	}
+	sorted := append([]models.ProjectPath{}, paths...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	if after, ok := p.Args["after"].(string); ok {
+		start := sort.Search(len(sorted), func(i int) bool { return string(sorted[i]) > after })
+		sorted = sorted[start:]
+	}
+	if len(sorted) > first {
+		sorted = sorted[:first]
+	}
+	return sorted, nil
+}
+
+func metadataField(fieldType graphql.Output, key string) *graphql.Field {
+	return &graphql.Field{
+		Type: fieldType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*graphProject).project[key], nil
+		},
+	}
+}
+
+func (r *graphResource) newSchema() (graphql.Schema, error) {
+	i18nType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "I18n",
+		Fields: graphql.Fields{
+			"stable":     &graphql.Field{Type: graphql.String},
+			"stable_kf5": &graphql.Field{Type: graphql.String},
+			"trunk":      &graphql.Field{Type: graphql.String},
+			"trunk_kf5":  &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	memberType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Member",
+		Fields: graphql.Fields{
+			"username":    &graphql.Field{Type: graphql.String},
+			"displayname": &graphql.Field{Type: graphql.String},
+			"email":       &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	var projectType *graphql.Object
+	projectType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Project",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"path": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.String),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*graphProject).path.String(), nil
+					},
+				},
+				"name":        metadataField(graphql.String, "name"),
+				"description": metadataField(graphql.String, "description"),
+				"icon":        metadataField(graphql.String, "icon"),
+				"type":        metadataField(graphql.String, "type"),
+				"projectpath": metadataField(graphql.String, "projectpath"),
+				"repopath":    metadataField(graphql.String, "repopath"),
+				"hasrepo":     metadataField(graphql.Boolean, "hasrepo"),
+				"repoactive":  metadataField(graphql.Boolean, "repoactive"),
+				"i18n":        metadataField(i18nType, "i18n"),
+				"members":     metadataField(graphql.NewList(memberType), "members"),
+				"parent": &graphql.Field{
+					Type: projectType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						parent, ok := p.Source.(*graphProject).path.Parent()
+						if !ok {
+							return nil, nil
+						}
+						project, err := r.project(p.Context, parent)
+						if err != nil {
+							return nil, nil // Parent directory is no project.
+						}
+						return project, nil
+					},
+				},
+				"children": &graphql.Field{
+					Type: graphql.NewList(projectType),
+					Args: pageArgs(nil),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						paths, err := r.service.Children(p.Context, p.Source.(*graphProject).path)
+						if err == nil {
+							paths, err = paginate(p, paths)
+						}
+						if err != nil {
+							return nil, err
+						}
+						return r.projects(p.Context, paths)
+					},
+				},
+			}
+		}),
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"project": &graphql.Field{
+				Type: projectType,
+				Args: graphql.FieldConfigArgument{
+					"path": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					path, err := models.ParseProjectPath(p.Args["path"].(string))
+					if err != nil {
+						return nil, err
+					}
+					return r.project(p.Context, path)
+				},
+			},
+			"projects": &graphql.Field{
+				Type: graphql.NewList(projectType),
+				Args: pageArgs(graphql.FieldConfigArgument{
+					"id":       &graphql.ArgumentConfig{Type: graphql.String},
+					"repopath": &graphql.ArgumentConfig{Type: graphql.String},
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, _ := p.Args["id"].(string)
+					repopath, _ := p.Args["repopath"].(string)
+					paths, err := r.service.Find(p.Context, id, repopath)
+					if err == nil {
+						paths, err = paginate(p, paths)
+					}
+					if err != nil {
+						return nil, err
+					}
+					return r.projects(p.Context, paths)
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+// Fields returning lists of projects. Their selections get multiplied by
+// the page size.
+var listFields = map[string]bool{"projects": true, "children": true}
+
+// pageSize is how many projects a list field may return at most.
+func pageSize(field *ast.Field) int {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		// Variables are unknown yet, they count as a full page.
+		if value, ok := arg.Value.(*ast.IntValue); ok {
+			if first, err := strconv.Atoi(value.Value); err == nil && first >= 0 && first < graphQLMaxPage {
+				return first
+			}
+		}
+	}
+	return graphQLMaxPage
+}
+
+type queryCost struct {
+	fragments map[string]*ast.FragmentDefinition
+	visiting  map[string]bool
+}
+
+// selectionCost returns the depth and complexity of a selection set.
+func (q *queryCost) selectionCost(set *ast.SelectionSet) (int, int, error) {
+	if set == nil {
+		return 0, 0, nil
+	}
+	maxDepth := 0
+	complexity := 0
+	for _, selection := range set.Selections {
+		var depth, cost int
+		var err error
+		switch x := selection.(type) {
+		case *ast.Field:
+			depth, cost, err = q.selectionCost(x.SelectionSet)
+			if listFields[x.Name.Value] {
+				cost *= pageSize(x)
+			}
+			depth++
+			cost++
+		case *ast.InlineFragment:
+			depth, cost, err = q.selectionCost(x.SelectionSet)
+		case *ast.FragmentSpread:
+			name := x.Name.Value
+			fragment, ok := q.fragments[name]
+			if !ok || q.visiting[name] {
+				return 0, 0, fmt.Errorf("invalid fragment %s", name)
+			}
+			q.visiting[name] = true
+			depth, cost, err = q.selectionCost(fragment.SelectionSet)
+			q.visiting[name] = false
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		// Pages multiply quickly, stop counting before it overflows.
+		complexity = min(complexity+cost, graphQLMaxComplexity+1)
+	}
+	return maxDepth, complexity, nil
+}
+
+// checkLimits rejects queries exceeding the depth or complexity limits
+// before anything is resolved.
+func checkLimits(query string) error {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return err
+	}
+	q := &queryCost{map[string]*ast.FragmentDefinition{}, map[string]bool{}}
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			q.fragments[fragment.Name.Value] = fragment
+		}
+	}
+	for _, definition := range doc.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		depth, complexity, err := q.selectionCost(operation.SelectionSet)
+		if err != nil {
+			return err
+		}
+		if depth > graphQLMaxDepth {
+			return fmt.Errorf("query depth %d exceeds limit of %d", depth, graphQLMaxDepth)
+		}
+		if complexity > graphQLMaxComplexity {
+			return fmt.Errorf("query complexity exceeds limit of %d", graphQLMaxComplexity)
+		}
+	}
+	return nil
+}
+
+type graphRequest struct {
+	Query         string                 `json:"query" form:"query"`
+	OperationName string                 `json:"operationName" form:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+/**
+ * @api {post} /graphql GraphQL
+ * @apiParam {String} query GraphQL query document.
+ * @apiParam {Object} [variables] Values of the query variables.
+ * @apiParam {String} [operationName] Operation to run if the document has
+ *   more than one.
+ *
+ * @apiVersion 1.0.0
+ * @apiGroup Project
+ * @apiName graphql
+ *
+ * @apiDescription Runs a GraphQL query over the project tree. Queries start
+ *   at <code>project(path)</code> or <code>projects(id, repopath)</code> and
+ *   may follow <code>parent</code> and <code>children</code> of any Project.
+ *   Queries may also be sent as GET with a <code>query</code> parameter.
+ *   Lists are paged in path order: <code>first</code> takes at most 500
+ *   projects, <code>after</code> continues after the path of the last
+ *   project of the previous page. Overly deep or complex queries are
+ *   rejected, lists count as many times as <code>first</code> allows for.
+ *
+ * @apiParamExample {json} Request-Example:
+ *   { "query": "{ project(path: \"frameworks\") { name children { repopath i18n { trunk_kf5 } } } }" }
+ *
+ * @apiSuccessExample {json} Success-Response:
+ *   {
+ *   "data": {
+ *     "project": {
+ *       "name": "KDE Frameworks",
+ *       "children": [ { "repopath": "solid", "i18n": { "trunk_kf5": "master" } }, ... ]
+ *     }
+ *   }
+ *   }
+ *
+ * @apiError BadRequest Query is missing, invalid or exceeds the limits.
+ */
+func (r *graphResource) query(c *gin.Context) {
+	var request graphRequest
+	var err error
+	if c.Request.Method == "POST" {
+		err = c.ShouldBindJSON(&request)
+	} else {
+		err = c.ShouldBindQuery(&request)
+	}
+	if err == nil && request.Query == "" {
+		err = errors.New("missing query")
+	}
+	if err == nil {
+		err = checkLimits(request.Query)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"errors": []gin.H{{"message": err.Error()}}})
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         r.schema,
+		RequestString:  request.Query,
+		VariableValues: request.Variables,
+		OperationName:  request.OperationName,
+		Context:        c.Request.Context(),
+	})
+	c.JSON(http.StatusOK, result)
+}
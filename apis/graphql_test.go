@@ -0,0 +1,93 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/apis"
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+)
+
+// Test Double
+type GraphService struct {
+}
+
+func (s *GraphService) Get(ctx context.Context, path models.ProjectPath) (models.Project, string, error) {
+	switch path {
+	case "calligra":
+		return models.Project{"repopath": "calligra"}, "rev", nil
+	case "calligra/krita":
+		return models.Project{"repopath": "krita", "members": []interface{}{
+			map[string]interface{}{"username": "boud"},
+		}}, "rev", nil
+	}
+	return nil, "", errors.New("unexpected path " + path.String())
+}
+
+func (s *GraphService) Find(ctx context.Context, id string, repopath string) ([]models.ProjectPath, error) {
+	return []models.ProjectPath{"calligra/krita", "calligra"}, nil
+}
+
+func (s *GraphService) Children(ctx context.Context, path models.ProjectPath) ([]models.ProjectPath, error) {
+	if path == "calligra" {
+		return []models.ProjectPath{"calligra/krita"}, nil
+	}
+	return []models.ProjectPath{}, nil
+}
+
+func init() {
+	v1 := router.Group("/v1")
+	{
+		apis.ServeGraphQLResource(v1, &GraphService{})
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	deep := "{ project(path: \"calligra\") { " + strings.Repeat("children { ", 10) +
+		"path" + strings.Repeat(" }", 10) + " } }"
+	runAPITests(t, []apiTestCase{
+		{"t1 - project", "POST", "/v1/graphql", `{"query": "{ project(path: \"calligra/krita\") { path repopath members { username } parent { repopath } } }"}`,
+			http.StatusOK, `{"data": {"project": {"path": "calligra/krita", "repopath": "krita", "members": [{"username": "boud"}], "parent": {"repopath": "calligra"}}}}`},
+		{"t2 - children", "GET", "/v1/graphql?query={project(path:\"calligra\"){children{path}}}", "",
+			http.StatusOK, `{"data": {"project": {"children": [{"path": "calligra/krita"}]}}}`},
+		{"t3 - projects", "POST", "/v1/graphql", `{"query": "query Q($r: String) { projects(repopath: $r) { path } }", "variables": {"r": "krita"}}`,
+			http.StatusOK, `{"data": {"projects": [{"path": "calligra"}, {"path": "calligra/krita"}]}}`},
+		{"t4 - too deep", "POST", "/v1/graphql", `{"query": "` + strings.Replace(deep, `"`, `\"`, -1) + `"}`,
+			http.StatusBadRequest, `{"errors": [{"message": "query depth 12 exceeds limit of 10"}]}`},
+		{"t5 - recursive fragment", "POST", "/v1/graphql", `{"query": "{ project(path: \"calligra\") { ...F } } fragment F on Project { children { ...F } }"}`,
+			http.StatusBadRequest, `{"errors": [{"message": "invalid fragment F"}]}`},
+		{"t6 - missing query", "POST", "/v1/graphql", `{}`,
+			http.StatusBadRequest, `{"errors": [{"message": "missing query"}]}`},
+		{"t7 - nested fan-out", "POST", "/v1/graphql", `{"query": "{ projects { parent { children { parent { children { path } } } } } }"}`,
+			http.StatusBadRequest, `{"errors": [{"message": "query complexity exceeds limit of 5000"}]}`},
+		{"t8 - small pages may nest", "POST", "/v1/graphql", `{"query": "{ projects(first: 10) { children(first: 10) { path } } }"}`,
+			http.StatusOK, `{"data": {"projects": [{"children": [{"path": "calligra/krita"}]}, {"children": []}]}}`},
+		{"t9 - next page", "POST", "/v1/graphql", `{"query": "{ projects(first: 1, after: \"calligra\") { path } }"}`,
+			http.StatusOK, `{"data": {"projects": [{"path": "calligra/krita"}]}}`},
+		{"t10 - page too large", "POST", "/v1/graphql", `{"query": "query Q($n: Int) { projects(first: $n) { path } }", "variables": {"n": 501}}`,
+			http.StatusOK, `{"data": {"projects": null}, "errors": [{"message": "first must be between 0 and 500", "locations": [{"line": 1, "column": 20}], "path": ["projects"]}]}`},
+	})
+}
@@ -0,0 +1,365 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itchyny/gojq"
+)
+
+// Limits of ?jq= filters. range and repeat generate at most jqMaxItems
+// values. The strings and arrays + and * build, and add and join, take at
+// most jqMaxBuilt bytes per run, an array element counting jqElementSize.
+const (
+	jqMaxLength     = 1024
+	jqTimeout       = time.Second
+	jqMaxOutput     = 1 << 20
+	jqMaxItems      = 10000
+	jqMaxBuilt      = 16 << 20
+	jqElementSize   = 16
+	jqMaxConcurrent = 4
+)
+
+var errJQOutputTooLarge = fmt.Errorf("jq output exceeds %d bytes", jqMaxOutput)
+
+// jqSlots is taken by every running filter.
+var jqSlots = make(chan struct{}, jqMaxConcurrent)
+
+// jqLimitError is raised by a filter going over a limit while it runs.
+type jqLimitError struct {
+	message string
+}
+
+func (e *jqLimitError) Error() string {
+	return e.message
+}
+
+// jqPrelude shadows the builtins that can build arbitrarily large values
+// with bounded ones. _add and _multiply are what + and * are turned into.
+var jqPrelude = fmt.Sprintf(`
+def range($from; $upto; $by):
+  if ($upto - $from) / $by > %[1]d then _limit("range exceeds %[1]d values")
+  else _range($from; $upto; $by) end;
+def range($from; $upto): range($from; $upto; 1);
+def range($upto): range(0; $upto; 1);
+def repeat(f):
+  foreach (def _repeat: f, _repeat; _repeat) as $v (0; . + 1;
+    if . > %[1]d then _limit("repeat exceeds %[1]d values") else $v end);
+def _add(l; r): _checked_add(l; r);
+def _multiply(l; r): _checked_multiply(l; r);
+def add: _checked_add_all;
+def join($sep): _checked_join($sep);
+.`, jqMaxItems)
+
+// jqReserved are the names filters may neither call nor define, they would
+// get around the prelude.
+var jqReserved = map[string]bool{
+	"_range": true, "_add": true, "_multiply": true, "_limit": true, "_checked_add": true,
+	"_checked_multiply": true, "_checked_add_all": true, "_checked_join": true,
+}
+
+// jqOperators are turned into calls of the bounded functions of the prelude.
+var jqOperators = map[gojq.Operator]string{gojq.OpAdd: "_add", gojq.OpMul: "_multiply"}
+
+// mustCompileJQ compiles the builtin behind one of the bounded functions.
+func mustCompileJQ(filter string, variables ...string) *gojq.Code {
+	query, err := gojq.Parse(filter)
+	if err != nil {
+		panic(err)
+	}
+	code, err := gojq.Compile(query, gojq.WithVariables(variables))
+	if err != nil {
+		panic(err)
+	}
+	return code
+}
+
+var (
+	jqAdd      = mustCompileJQ(".[0] + .[1]")
+	jqMultiply = mustCompileJQ(".[0] * .[1]")
+	jqAddAll   = mustCompileJQ("add")
+	jqJoin     = mustCompileJQ("join($sep)", "$sep")
+)
+
+// jqBudget counts what one run of a filter builds. Values are checked
+// before they are built.
+type jqBudget struct {
+	built float64
+}
+
+// sizeOf is what string or array v takes against the budget.
+func sizeOf(v interface{}) float64 {
+	switch v := v.(type) {
+	case string:
+		return float64(len(v))
+	case []interface{}:
+		return float64(jqElementSize * len(v))
+	}
+	return 0
+}
+
+func (b *jqBudget) charge(size float64) *jqLimitError {
+	b.built += size
+	if b.built > jqMaxBuilt {
+		return &jqLimitError{fmt.Sprintf("jq filter builds more than %d bytes of strings and arrays", jqMaxBuilt)}
+	}
+	return nil
+}
+
+// add is + charging the strings and arrays it concatenates.
+func (b *jqBudget) add(_ interface{}, args []interface{}) interface{} {
+	if err := b.charge(sizeOf(args[0]) + sizeOf(args[1])); err != nil {
+		return err
+	}
+	v, _ := jqAdd.Run(args).Next()
+	return v
+}
+
+// multiply is * charging the strings it repeats.
+func (b *jqBudget) multiply(_ interface{}, args []interface{}) interface{} {
+	for i, arg := range args {
+		str, ok := arg.(string)
+		if !ok || str == "" {
+			continue
+		}
+		times := 0.0
+		switch n := args[1-i].(type) {
+		case int:
+			times = float64(n)
+		case float64:
+			times = n
+		case *big.Int:
+			times, _ = new(big.Float).SetInt(n).Float64()
+		}
+		if err := b.charge(float64(len(str)) * max(times, 0)); err != nil {
+			return err
+		}
+	}
+	v, _ := jqMultiply.Run(args).Next()
+	return v
+}
+
+// addAll is add charging the elements it concatenates.
+func (b *jqBudget) addAll(v interface{}, _ []interface{}) interface{} {
+	if values, ok := v.([]interface{}); ok {
+		size := 0.0
+		for _, value := range values {
+			size += sizeOf(value)
+		}
+		if err := b.charge(size); err != nil {
+			return err
+		}
+	}
+	v, _ = jqAddAll.Run(v).Next()
+	return v
+}
+
+// join is join charging the strings it concatenates.
+func (b *jqBudget) join(v interface{}, args []interface{}) interface{} {
+	if values, ok := v.([]interface{}); ok {
+		size := float64(len(values)) * sizeOf(args[0])
+		for _, value := range values {
+			size += sizeOf(value)
+		}
+		if err := b.charge(size); err != nil {
+			return err
+		}
+	}
+	v, _ = jqJoin.Run(v, args[0]).Next()
+	return v
+}
+
+// guardJQ rejects reserved names in query and turns its additions and
+// multiplications into function calls. Unlike functions, operators cannot
+// be shadowed.
+func guardJQ(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		switch node := v.Interface().(type) {
+		case *gojq.Func:
+			if jqReserved[node.Name] {
+				return fmt.Errorf("function not defined: %s/%d", node.Name, len(node.Args))
+			}
+		case *gojq.FuncDef:
+			if jqReserved[node.Name] {
+				return fmt.Errorf("cannot define %s", node.Name)
+			}
+		}
+		if err := guardJQ(v.Elem()); err != nil {
+			return err
+		}
+		// After the children were checked, the call added is no user's.
+		if query, ok := v.Interface().(*gojq.Query); ok && jqOperators[query.Op] != "" {
+			query.Term = &gojq.Term{Type: gojq.TermTypeFunc, Func: &gojq.Func{
+				Name: jqOperators[query.Op], Args: []*gojq.Query{query.Left, query.Right}}}
+			query.Left, query.Right, query.Op = nil, nil, 0
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if err := guardJQ(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := guardJQ(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compileJQ compiles a filter. The environment of the server stays hidden,
+// neither modules nor further inputs are available.
+func compileJQ(filter string) (*gojq.Code, error) {
+	if len(filter) > jqMaxLength {
+		return nil, fmt.Errorf("jq filter exceeds %d bytes", jqMaxLength)
+	}
+	query, err := gojq.Parse(filter)
+	if err != nil {
+		return nil, err
+	}
+	if err = guardJQ(reflect.ValueOf(query)); err != nil {
+		return nil, err
+	}
+	prelude, err := gojq.Parse(jqPrelude)
+	if err != nil {
+		return nil, err
+	}
+	query.FuncDefs = append(prelude.FuncDefs, query.FuncDefs...)
+	budget := &jqBudget{}
+	return gojq.Compile(query,
+		gojq.WithEnvironLoader(func() []string { return nil }),
+		gojq.WithFunction("_checked_add", 2, 2, budget.add),
+		gojq.WithFunction("_checked_multiply", 2, 2, budget.multiply),
+		gojq.WithFunction("_checked_add_all", 0, 0, budget.addAll),
+		gojq.WithFunction("_checked_join", 1, 1, budget.join),
+		gojq.WithFunction("_limit", 1, 1, func(_ interface{}, args []interface{}) interface{} {
+			message, _ := args[0].(string)
+			return &jqLimitError{message}
+		}))
+}
+
+// runJQ runs code over the JSON of obj. Results are written like jq does,
+// one per line. With raw strings are written as is rather than as JSON.
+func runJQ(ctx context.Context, code *gojq.Code, obj interface{}, raw bool) ([]byte, int, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, 0, err
+	}
+	var input interface{}
+	if err = json.Unmarshal(data, &input); err != nil {
+		return nil, 0, err
+	}
+
+	var out bytes.Buffer
+	count := 0
+	iter := code.RunWithContext(ctx, input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			return out.Bytes(), count, nil
+		}
+		if err, ok := v.(error); ok {
+			return nil, 0, err
+		}
+		if str, ok := v.(string); ok && raw {
+			out.WriteString(str)
+		} else {
+			line, err := json.Marshal(v)
+			if err != nil {
+				return nil, 0, err
+			}
+			out.Write(line)
+		}
+		out.WriteByte('\n')
+		count++
+		if out.Len() > jqMaxOutput {
+			return nil, 0, errJQOutputTooLarge
+		}
+	}
+}
+
+// renderJQ renders obj, filtered through the ?jq= filter if there is one.
+// Filters see the JSON of obj regardless of the negotiated format.
+func renderJQ(c *gin.Context, code int, obj interface{}) {
+	filter := c.Query("jq")
+	if filter == "" {
+		render(c, code, obj)
+		return
+	}
+	raw, _ := strconv.ParseBool(c.Query("raw"))
+
+	compiled, err := compileJQ(filter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	wait, cancel := context.WithTimeout(c.Request.Context(), jqTimeout)
+	defer cancel()
+	select {
+	case jqSlots <- struct{}{}:
+		defer func() { <-jqSlots }()
+	case <-wait.Done():
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "too many jq filters running"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), jqTimeout)
+	defer cancel()
+	body, count, err := runJQ(ctx, compiled, obj, raw)
+	var limitErr *jqLimitError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "jq filter timed out after " + jqTimeout.String()})
+		return
+	case err == errJQOutputTooLarge, errors.As(err, &limitErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	contentType := mimeNDJSON
+	switch {
+	case raw:
+		contentType = "text/plain"
+	case count == 1:
+		contentType = mimeJSON
+	}
+	cachedData(c, code, contentType+"; charset=utf-8", body)
+}
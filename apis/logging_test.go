@@ -0,0 +1,85 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/apis"
+	"anongit.kde.org/websites/api-projects-kde-org.git/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var logBuffer bytes.Buffer
+
+func init() {
+	logger := slog.New(slog.NewJSONHandler(&logBuffer, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	logged := router.Group("/logged", apis.RequestLogger(logger))
+	{
+		logged.GET("/ping", func(c *gin.Context) {
+			logging.FromContext(c.Request.Context(), nil).Debug("pinged")
+			c.JSON(http.StatusOK, "pong")
+		})
+	}
+}
+
+func loggedRecords(t *testing.T) []map[string]interface{} {
+	records := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(logBuffer.String()), "\n") {
+		record := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	logBuffer.Reset()
+	return records
+}
+
+func TestRequestLogger(t *testing.T) {
+	res := testAPI("GET", "/logged/ping", "")
+	id := res.Header().Get("X-Request-ID")
+	assert.Len(t, id, 16)
+	records := loggedRecords(t)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "pinged", records[0]["msg"])
+	assert.Equal(t, id, records[0]["request_id"])
+	assert.Equal(t, "request", records[1]["msg"])
+	assert.Equal(t, id, records[1]["request_id"])
+	assert.Equal(t, "/logged/ping", records[1]["path"])
+	assert.Equal(t, float64(http.StatusOK), records[1]["status"])
+
+	// IDs from upstream proxies are kept, unless they are garbage.
+	for sent, kept := range map[string]bool{"abc-123": true, "no spaces please": false} {
+		req, _ := http.NewRequest("GET", "/logged/ping", nil)
+		req.Header.Set("X-Request-ID", sent)
+		res = httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		assert.Equal(t, kept, res.Header().Get("X-Request-ID") == sent, sent)
+		assert.Equal(t, res.Header().Get("X-Request-ID"), loggedRecords(t)[0]["request_id"])
+	}
+}
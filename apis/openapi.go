@@ -0,0 +1,614 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// operation documents one route. Routes are looked up by method and the
+// gin path relative to the group they are served on.
+type operation struct {
+	Summary     string
+	Description string
+	Parameters  []gin.H
+	RequestBody gin.H
+	Responses   map[int]gin.H
+	// Scope a bearer token needs, empty for anonymous routes.
+	Scope string
+}
+
+func pathParam(name string, description string) gin.H {
+	return gin.H{"name": name, "in": "path", "required": true,
+		"description": description, "schema": gin.H{"type": "string"}}
+}
+
+func queryParam(name string, description string) gin.H {
+	return gin.H{"name": name, "in": "query", "required": false,
+		"description": description, "schema": gin.H{"type": "string"}}
+}
+
+func ref(name string) gin.H {
+	return gin.H{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonResponse(description string, schema gin.H) gin.H {
+	return gin.H{
+		"description": description,
+		"content":     gin.H{mimeJSON: gin.H{"schema": schema}},
+	}
+}
+
+var formatParams = []gin.H{
+	queryParam("format", "One of json, yaml, csv or ndjson. Overrides the Accept header."),
+	queryParam("columns", "Comma separated flattened columns of csv output."),
+}
+
+var jqParams = []gin.H{
+	queryParam("jq", "jq filter applied to the JSON of the response. Results are written one per line."),
+	queryParam("raw", "Write string results of jq as plain text."),
+}
+
+var jqResponses = map[int]gin.H{
+	http.StatusBadRequest:          jsonResponse("Invalid or failing jq filter.", ref("Error")),
+	http.StatusUnprocessableEntity: jsonResponse("jq filter exceeded its time, size or output limit.", ref("Error")),
+	http.StatusServiceUnavailable:  jsonResponse("Too many jq filters running, retry after Retry-After seconds.", ref("Error")),
+}
+
+var dependencyParams = []gin.H{
+	pathParam("path", "Path of the project, e.g. frameworks/solid."),
+	queryParam("branchgroup", "Branch group of the dependency data, defaults to kf5-qt5."),
+}
+
+func dependencyResponses(description string) map[int]gin.H {
+	return map[int]gin.H{
+		http.StatusOK:        jsonResponse(description, ref("Paths")),
+		http.StatusForbidden: gin.H{"description": "Path may not be accessed."},
+		http.StatusNotFound:  jsonResponse("Unknown project or branch group.", ref("Error")),
+	}
+}
+
+// withResponses adds responses to a copy of base.
+func withResponses(base map[int]gin.H, responses map[int]gin.H) map[int]gin.H {
+	all := map[int]gin.H{}
+	for code, response := range base {
+		all[code] = response
+	}
+	for code, response := range responses {
+		all[code] = response
+	}
+	return all
+}
+
+// counts maps names to how often they occur.
+var counts = gin.H{"type": "object", "additionalProperties": gin.H{"type": "integer"}}
+
+// openAPISchemas are the reusable response schemas.
+var openAPISchemas = gin.H{
+	"Project": gin.H{
+		"type": "object",
+		"properties": gin.H{
+			"name":        gin.H{"type": "string"},
+			"description": gin.H{"type": "string", "nullable": true},
+			"icon":        gin.H{"type": "string", "nullable": true},
+			"type":        gin.H{"type": "string"},
+			"projectpath": gin.H{"type": "string"},
+			"repopath":    gin.H{"type": "string", "nullable": true},
+			"hasrepo":     gin.H{"type": "boolean"},
+			"repoactive":  gin.H{"type": "boolean"},
+			"i18n": gin.H{
+				"type":                 "object",
+				"additionalProperties": gin.H{"type": "string"},
+			},
+			"members": gin.H{
+				"type":  "array",
+				"items": gin.H{"type": "object"},
+			},
+			"urls": gin.H{
+				"type":                 "object",
+				"additionalProperties": gin.H{"type": "string"},
+			},
+			"aliases": gin.H{
+				"type":        "array",
+				"description": "Paths the project was moved away from. Only present for moved projects.",
+				"items":       gin.H{"type": "string"},
+			},
+			"provenance": gin.H{
+				"type":                 "object",
+				"description":          "Layer each field came from. Only present when layers are configured.",
+				"additionalProperties": gin.H{"type": "string"},
+			},
+		},
+		"additionalProperties": true,
+	},
+	"Projects": gin.H{
+		"type":     "object",
+		"required": []string{"projects", "errors"},
+		"properties": gin.H{
+			"projects": gin.H{"type": "object", "additionalProperties": ref("Project")},
+			"errors":   gin.H{"type": "object", "additionalProperties": gin.H{"type": "string"}},
+		},
+	},
+	"Paths": gin.H{
+		"type":  "array",
+		"items": gin.H{"type": "string"},
+	},
+	"Error": gin.H{
+		"type":       "object",
+		"required":   []string{"error"},
+		"properties": gin.H{"error": gin.H{"type": "string"}},
+	},
+	"NotFound": gin.H{
+		"type":     "object",
+		"required": []string{"error", "suggestions"},
+		"properties": gin.H{
+			"error":       gin.H{"type": "string"},
+			"suggestions": ref("Paths"),
+		},
+	},
+	"Stats": gin.H{
+		"type": "object",
+		"required": []string{"revision", "revision_time", "projects", "groups", "hasrepo", "without_repo",
+			"active_repos", "inactive_repos", "i18n", "without_members"},
+		"properties": gin.H{
+			"revision":      gin.H{"type": "string"},
+			"revision_time": gin.H{"type": "string", "format": "date-time"},
+			"projects":      gin.H{"type": "integer"},
+			"groups": gin.H{
+				"type":                 "object",
+				"description":          "Counts by top level group and type.",
+				"additionalProperties": counts,
+			},
+			"hasrepo":        gin.H{"type": "integer"},
+			"without_repo":   gin.H{"type": "integer"},
+			"active_repos":   gin.H{"type": "integer"},
+			"inactive_repos": gin.H{"type": "integer"},
+			"i18n": gin.H{
+				"type":                 "object",
+				"description":          "Counts by i18n key and resolved branch.",
+				"additionalProperties": counts,
+			},
+			"without_members": gin.H{"type": "integer"},
+		},
+	},
+	"StatsReport": gin.H{
+		"type":     "object",
+		"required": []string{"current", "series"},
+		"properties": gin.H{
+			"current": ref("Stats"),
+			"series":  gin.H{"type": "array", "items": ref("Stats")},
+		},
+	},
+	"Completions": gin.H{
+		"type": "array",
+		"items": gin.H{
+			"type":     "object",
+			"required": []string{"path", "name", "field", "match"},
+			"properties": gin.H{
+				"path":     gin.H{"type": "string"},
+				"name":     gin.H{"type": "string"},
+				"repopath": gin.H{"type": "string"},
+				"field":    gin.H{"type": "string", "enum": []string{"path", "name", "repopath"}},
+				"match":    gin.H{"type": "string", "enum": []string{"prefix", "substring", "fuzzy"}},
+			},
+		},
+	},
+	"Diff": gin.H{
+		"type":     "object",
+		"required": []string{"from", "to", "added", "removed", "moved", "modified"},
+		"properties": gin.H{
+			"from":    gin.H{"type": "string"},
+			"to":      gin.H{"type": "string"},
+			"added":   ref("Paths"),
+			"removed": ref("Paths"),
+			"moved": gin.H{"type": "array", "items": gin.H{
+				"type":     "object",
+				"required": []string{"from", "to", "repopath"},
+				"properties": gin.H{
+					"from":     gin.H{"type": "string"},
+					"to":       gin.H{"type": "string"},
+					"repopath": gin.H{"type": "string"},
+				},
+			}},
+			"modified": gin.H{"type": "object", "additionalProperties": gin.H{
+				"type": "array", "items": gin.H{
+					"type":       "object",
+					"required":   []string{"field"},
+					"properties": gin.H{"field": gin.H{"type": "string"}},
+				},
+			}},
+		},
+	},
+	"PollJob": gin.H{
+		"type": "object",
+		"required": []string{"id", "state", "old_revision", "new_revision", "changed_projects",
+			"output", "queued_at", "started_at", "finished_at"},
+		"properties": gin.H{
+			"id":               gin.H{"type": "string"},
+			"state":            gin.H{"type": "string", "enum": []string{"queued", "running", "succeeded", "failed"}},
+			"old_revision":     gin.H{"type": "string"},
+			"new_revision":     gin.H{"type": "string"},
+			"changed_projects": gin.H{"type": "integer"},
+			"output":           gin.H{"type": "string"},
+			"error":            gin.H{"type": "string"},
+			"queued_at":        gin.H{"type": "string", "format": "date-time"},
+			"started_at":       gin.H{"type": "string", "format": "date-time", "nullable": true},
+			"finished_at":      gin.H{"type": "string", "format": "date-time", "nullable": true},
+		},
+	},
+	"QueryResult": gin.H{
+		"type":     "object",
+		"required": []string{"revision", "columns", "rows", "truncated"},
+		"properties": gin.H{
+			"revision":  gin.H{"type": "string"},
+			"columns":   gin.H{"type": "array", "items": gin.H{"type": "string"}},
+			"rows":      gin.H{"type": "array", "items": gin.H{"type": "array", "items": gin.H{"nullable": true}}},
+			"truncated": gin.H{"type": "boolean"},
+		},
+	},
+	"GraphQLResult": gin.H{
+		"type": "object",
+		"properties": gin.H{
+			"data":   gin.H{"type": "object", "nullable": true},
+			"errors": gin.H{"type": "array", "items": gin.H{"type": "object"}},
+		},
+	},
+}
+
+var sqlResponses = map[int]gin.H{
+	http.StatusOK:                  jsonResponse("Query result.", ref("QueryResult")),
+	http.StatusBadRequest:          jsonResponse("Query is missing, invalid or would write, or its result exceeds 8 MiB.", ref("Error")),
+	http.StatusUnauthorized:        jsonResponse("No or an unknown token.", ref("Error")),
+	http.StatusForbidden:           jsonResponse("Token lacks the read scope.", ref("Error")),
+	http.StatusUnprocessableEntity: jsonResponse("Query ran out of time.", ref("Error")),
+}
+
+var operations = map[string]operation{
+	"POST /poll": {
+		Summary: "Update Clone",
+		Description: "Queues an update of the internal repo-metadata clone. Polls while an update is queued " +
+			"join it. Subject to a stricter rate limit than other routes.",
+		Scope: "poll",
+		Responses: map[int]gin.H{
+			http.StatusAccepted:        jsonResponse("The job, to be followed at the Location.", ref("PollJob")),
+			http.StatusUnauthorized:    jsonResponse("No or an unknown token.", ref("Error")),
+			http.StatusForbidden:       jsonResponse("Token lacks the poll scope.", ref("Error")),
+			http.StatusTooManyRequests: jsonResponse("Rate limit exceeded, see Retry-After.", gin.H{"type": "string"}),
+		},
+	},
+	"GET /poll/:id": {
+		Summary:     "Update Job",
+		Description: "Reports on an update queued by poll. Finished jobs are forgotten eventually.",
+		Parameters:  []gin.H{pathParam("id", "Identifier of the job.")},
+		Scope:       "poll",
+		Responses: map[int]gin.H{
+			http.StatusOK:           jsonResponse("The job.", ref("PollJob")),
+			http.StatusUnauthorized: jsonResponse("No or an unknown token.", ref("Error")),
+			http.StatusForbidden:    jsonResponse("Token lacks the poll scope.", ref("Error")),
+			http.StatusNotFound:     jsonResponse("No such job.", ref("Error")),
+		},
+	},
+	"GET /project/*path": {
+		Summary: "Get",
+		Description: "Gets the metadata of the project identified by path. The path may contain slashes. " +
+			"Old paths of moved projects redirect to the current path.",
+		Parameters: append(append([]gin.H{pathParam("path", "Path of the project, e.g. frameworks/solid.")},
+			formatParams...), jqParams...),
+		Responses: withResponses(map[int]gin.H{
+			http.StatusOK: jsonResponse("The project.", ref("Project")),
+			http.StatusMovedPermanently: gin.H{
+				"description": "The project was moved, Location is its current path.",
+				"headers":     gin.H{"Location": gin.H{"schema": gin.H{"type": "string"}}},
+			},
+			http.StatusForbidden: gin.H{"description": "Path may not be accessed."},
+			http.StatusNotFound:  jsonResponse("No project at the path.", ref("NotFound")),
+		}, jqResponses),
+	},
+	"POST /projects": {
+		Summary:     "Get Many",
+		Description: "Gets the metadata of many projects from one revision.",
+		RequestBody: gin.H{
+			"required": true,
+			"content": gin.H{mimeJSON: gin.H{"schema": gin.H{
+				"type": "array", "items": gin.H{"type": "string"}, "maxItems": 500,
+			}}},
+		},
+		Responses: map[int]gin.H{
+			http.StatusOK:         jsonResponse("Projects by requested path or repopath.", ref("Projects")),
+			http.StatusBadRequest: gin.H{"description": "Body is not a JSON array of strings or has more than 500 entries."},
+		},
+	},
+	"GET /find": {
+		Summary:     "Find",
+		Description: "Finds matching projects by a combination of filter params or none to list all projects.",
+		Parameters: append(append([]gin.H{
+			queryParam("id", "Identifier (basename) of the project to find."),
+			queryParam("repopath", "repopath attribute of the project to find."),
+		}, formatParams...), jqParams...),
+		Responses: withResponses(map[int]gin.H{
+			http.StatusOK:        jsonResponse("Paths of matching projects.", ref("Paths")),
+			http.StatusForbidden: gin.H{"description": "A matching path may not be accessed."},
+			http.StatusNotFound:  gin.H{"description": "Nothing matched."},
+		}, jqResponses),
+	},
+	"GET /complete": {
+		Summary: "Complete",
+		Description: "Completes project paths, names and repopaths for typeahead. Prefixes rank before " +
+			"substrings, which rank before fuzzy matches.",
+		Parameters: []gin.H{
+			queryParam("q", "What was typed so far."),
+			queryParam("limit", "Maximum number of completions, 10 by default and at most 50."),
+		},
+		Responses: map[int]gin.H{
+			http.StatusOK:         jsonResponse("Matching projects, best first.", ref("Completions")),
+			http.StatusBadRequest: jsonResponse("q is missing or limit out of range.", ref("Error")),
+		},
+	},
+	"GET /stats": {
+		Summary: "Stats",
+		Description: "Aggregates over the projects of the served revision and, in series, of recent " +
+			"revisions of repo-metadata alone.",
+		Parameters: []gin.H{
+			queryParam("revisions", "Number of recent revisions in series, 10 by default and at most 50 "+
+				"with a token, 10 without."),
+		},
+		Responses: map[int]gin.H{
+			http.StatusOK:         jsonResponse("The stats.", ref("StatsReport")),
+			http.StatusBadRequest: jsonResponse("revisions out of range.", ref("Error")),
+		},
+	},
+	"GET /graphql": {
+		Summary:    "GraphQL",
+		Parameters: []gin.H{queryParam("query", "GraphQL query document.")},
+		Responses: map[int]gin.H{
+			http.StatusOK:         jsonResponse("Query result.", ref("GraphQLResult")),
+			http.StatusBadRequest: jsonResponse("Invalid query.", ref("GraphQLResult")),
+		},
+	},
+	"POST /graphql": {
+		Summary: "GraphQL",
+		RequestBody: gin.H{
+			"required": true,
+			"content": gin.H{mimeJSON: gin.H{"schema": gin.H{
+				"type":     "object",
+				"required": []string{"query"},
+				"properties": gin.H{
+					"query":         gin.H{"type": "string"},
+					"operationName": gin.H{"type": "string"},
+					"variables":     gin.H{"type": "object"},
+				},
+			}}},
+		},
+		Responses: map[int]gin.H{
+			http.StatusOK:         jsonResponse("Query result.", ref("GraphQLResult")),
+			http.StatusBadRequest: jsonResponse("Invalid query.", ref("GraphQLResult")),
+		},
+	},
+	"GET /project/*path/dependencies": {
+		Summary:     "Dependencies",
+		Description: "Lists the direct dependencies of the project according to kde-build-metadata.",
+		Parameters:  dependencyParams,
+		Responses:   dependencyResponses("Paths of the dependencies."),
+	},
+	"GET /project/*path/dependents": {
+		Summary:     "Dependents",
+		Description: "Lists the projects directly depending on the project according to kde-build-metadata.",
+		Parameters:  dependencyParams,
+		Responses:   dependencyResponses("Paths of the dependents."),
+	},
+	"GET /buildorder": {
+		Summary:     "Build Order",
+		Description: "Orders projects and their transitive dependencies so dependencies come first.",
+		Parameters: []gin.H{
+			queryParam("project", "Project path to build. May be repeated or comma separated."),
+			queryParam("branchgroup", "Branch group of the dependency data, defaults to kf5-qt5."),
+		},
+		Responses: map[int]gin.H{
+			http.StatusOK:         jsonResponse("Project paths in build order.", ref("Paths")),
+			http.StatusBadRequest: jsonResponse("No or invalid projects.", ref("Error")),
+			http.StatusNotFound:   jsonResponse("Unknown project or branch group.", ref("Error")),
+			http.StatusConflict:   jsonResponse("The dependencies form a cycle.", ref("Error")),
+		},
+	},
+	"GET /branchgroup/:group": {
+		Summary:     "Branches",
+		Description: "Resolves the git branch of every project in a branch group.",
+		Parameters:  []gin.H{pathParam("group", "Branch group, e.g. kf5-qt5.")},
+		Responses: map[int]gin.H{
+			http.StatusOK: jsonResponse("Branches by project path.",
+				gin.H{"type": "object", "additionalProperties": gin.H{"type": "string"}}),
+			http.StatusNotFound:           jsonResponse("Unknown branch group.", ref("Error")),
+			http.StatusServiceUnavailable: jsonResponse("No logical-module-structure in kde-build-metadata.", ref("Error")),
+		},
+	},
+	"GET /branchgroup/:group/*path": {
+		Summary:     "Branch",
+		Description: "Resolves the git branch of a project in a branch group.",
+		Parameters: []gin.H{
+			pathParam("group", "Branch group, e.g. kf5-qt5."),
+			pathParam("path", "Path of the project, e.g. frameworks/solid."),
+		},
+		Responses: map[int]gin.H{
+			http.StatusOK:                 jsonResponse("The branch.", gin.H{"type": "string"}),
+			http.StatusForbidden:          gin.H{"description": "Path may not be accessed."},
+			http.StatusNotFound:           jsonResponse("Unknown project or branch group or no branch.", ref("Error")),
+			http.StatusServiceUnavailable: jsonResponse("No logical-module-structure in kde-build-metadata.", ref("Error")),
+		},
+	},
+	"GET /diff": {
+		Summary:     "Diff",
+		Description: "Compares the resolved metadata of two repo-metadata revisions.",
+		Parameters: []gin.H{
+			queryParam("from", "Revision to compare from. Without a token one of the 20 revisions before to."),
+			queryParam("to", "Revision to compare to, defaults to and without a token has to be the served revision."),
+		},
+		Responses: map[int]gin.H{
+			http.StatusOK:         jsonResponse("The changes.", ref("Diff")),
+			http.StatusBadRequest: jsonResponse("No from revision, or without a token to given or from out of range.", ref("Error")),
+			http.StatusNotFound:   jsonResponse("Unknown revision.", ref("Error")),
+		},
+	},
+	"GET /sql": {
+		Summary:     "SQL",
+		Description: "Queries a SQLite database of the served revision. See POST /sql.",
+		Parameters: []gin.H{
+			queryParam("query", "SQLite statement, only reading ones are allowed."),
+			queryParam("limit", "Maximum number of rows, at most 10000. 0 or none is the default of 1000."),
+		},
+		Scope:     "read",
+		Responses: sqlResponses,
+	},
+	"POST /sql": {
+		Summary: "SQL",
+		Description: "Queries a SQLite database of the resolved projects of the served revision. " +
+			"Statements are interrupted after 5 seconds. The tables are meta (key, value), " +
+			"projects (path, toplevel, name, description, icon, type, repopath, hasrepo, repoactive, json), " +
+			"i18n (path, key, value) and members (path, username, displayname, email, json).",
+		RequestBody: gin.H{
+			"required": true,
+			"content": gin.H{mimeJSON: gin.H{"schema": gin.H{
+				"type":     "object",
+				"required": []string{"query"},
+				"properties": gin.H{
+					"query": gin.H{"type": "string"},
+					"limit": gin.H{"type": "integer"},
+				},
+			}}},
+		},
+		Scope:     "read",
+		Responses: sqlResponses,
+	},
+	"GET /sql/metadata.sqlite": {
+		Summary:     "SQLite Database",
+		Description: "Downloads the SQLite database of the served revision.",
+		Scope:       "read",
+		Responses: map[int]gin.H{
+			http.StatusOK: gin.H{
+				"description": "The database.",
+				"content":     gin.H{"application/vnd.sqlite3": gin.H{"schema": gin.H{"type": "string", "format": "binary"}}},
+			},
+			http.StatusUnauthorized: jsonResponse("No or an unknown token.", ref("Error")),
+			http.StatusForbidden:    jsonResponse("Token lacks the read scope.", ref("Error")),
+		},
+	},
+	"GET /openapi.json": {
+		Summary: "OpenAPI",
+		Responses: map[int]gin.H{
+			http.StatusOK: jsonResponse("This specification.", gin.H{"type": "object"}),
+		},
+	},
+}
+
+var ginParam = regexp.MustCompile(`[:*]([^/]+)`)
+
+type routesFunc func() gin.RoutesInfo
+
+type openAPIResource struct {
+	basePath string
+	routes   routesFunc
+}
+
+// ServeOpenAPIResource serves an OpenAPI 3 specification of all routes
+// below the group. routes is usually the Routes method of the engine, it is
+// only called when the spec is requested so routes registered later are
+// included.
+func ServeOpenAPIResource(rg *gin.RouterGroup, routes routesFunc) {
+	r := &openAPIResource{rg.BasePath(), routes}
+	rg.GET("/openapi.json", r.get)
+}
+
+// OpenAPISpec builds the specification of all routes below basePath.
+func OpenAPISpec(basePath string, routes gin.RoutesInfo) gin.H {
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+
+	paths := gin.H{}
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, basePath+"/") {
+			continue
+		}
+		relative := strings.TrimPrefix(route.Path, basePath)
+		op, ok := operations[route.Method+" "+relative]
+		if !ok {
+			op = operation{Summary: "Undocumented",
+				Responses: map[int]gin.H{http.StatusOK: {"description": "Undocumented."}}}
+		}
+		entry := gin.H{"summary": op.Summary}
+		if op.Description != "" {
+			entry["description"] = op.Description
+		}
+		if len(op.Parameters) > 0 {
+			entry["parameters"] = op.Parameters
+		}
+		if op.RequestBody != nil {
+			entry["requestBody"] = op.RequestBody
+		}
+		if op.Scope != "" {
+			entry["security"] = []gin.H{{"bearer": []string{op.Scope}}}
+		}
+		responses := gin.H{}
+		for code, response := range op.Responses {
+			responses[strconv.Itoa(code)] = response
+		}
+		entry["responses"] = responses
+
+		specPath := ginParam.ReplaceAllString(route.Path, "{$1}")
+		item, ok := paths[specPath].(gin.H)
+		if !ok {
+			item = gin.H{}
+			paths[specPath] = item
+		}
+		item[strings.ToLower(route.Method)] = entry
+	}
+
+	return gin.H{
+		"openapi": "3.0.0",
+		"info": gin.H{
+			"title":   "api.projects.kde.org",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": gin.H{
+			"schemas": openAPISchemas,
+			"securitySchemes": gin.H{
+				"bearer": gin.H{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+/**
+ * @api {get} /openapi.json OpenAPI
+ *
+ * @apiVersion 1.0.0
+ * @apiGroup Project
+ * @apiName openapi
+ *
+ * @apiDescription Gets an OpenAPI 3 specification of this API.
+ */
+func (r *openAPIResource) get(c *gin.Context) {
+	c.JSON(http.StatusOK, OpenAPISpec(r.basePath, r.routes()))
+}
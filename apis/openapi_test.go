@@ -0,0 +1,185 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/apis"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	v1 := router.Group("/v1")
+	{
+		apis.ServeOpenAPIResource(v1, func() gin.RoutesInfo {
+			return append(router.Routes(), subresources.Routes()...)
+		})
+	}
+}
+
+// validate checks value against a (small) subset of OpenAPI schemas. It
+// knows enough to catch handlers drifting away from the spec.
+func validate(spec map[string]interface{}, schema map[string]interface{}, value interface{}, at string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+		return validate(spec, schemas[name].(map[string]interface{}), value, at)
+	}
+	if value == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return fmt.Errorf("%s: unexpected null", at)
+	}
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %T", at, value)
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, key := range required {
+			if _, ok := obj[key.(string)]; !ok {
+				return fmt.Errorf("%s: missing %s", at, key)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for key, v := range obj {
+			if property, ok := properties[key]; ok {
+				if err := validate(spec, property.(map[string]interface{}), v, at+"."+key); err != nil {
+					return err
+				}
+				continue
+			}
+			if additional, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+				if err := validate(spec, additional, v, at+"."+key); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %T", at, value)
+		}
+		for i, v := range list {
+			if err := validate(spec, schema["items"].(map[string]interface{}), v, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: expected string, got %T", at, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %T", at, value)
+		}
+	case "integer":
+		if number, ok := value.(float64); !ok || number != float64(int64(number)) {
+			return fmt.Errorf("%s: expected integer, got %v", at, value)
+		}
+	}
+	return nil
+}
+
+func TestOpenAPIDocumentsAllRoutes(t *testing.T) {
+	res := testAPI("GET", "/v1/openapi.json", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	var spec map[string]interface{}
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &spec))
+
+	paths := spec["paths"].(map[string]interface{})
+	assert.Contains(t, paths, "/v1/project/{path}")
+	assert.Contains(t, paths, "/v1/find")
+	assert.Contains(t, paths, "/v1/poll")
+	for _, route := range subresources.Routes() {
+		assert.Contains(t, paths, strings.Replace(route.Path, "*path", "{path}", 1))
+	}
+	poll := paths["/v1/poll"].(map[string]interface{})["post"].(map[string]interface{})
+	assert.Equal(t, []interface{}{map[string]interface{}{"bearer": []interface{}{"poll"}}}, poll["security"])
+	for path, item := range paths {
+		for method, entry := range item.(map[string]interface{}) {
+			assert.NotEqual(t, "Undocumented", entry.(map[string]interface{})["summary"], method+" "+path)
+		}
+	}
+}
+
+func TestOpenAPIMatchesHandlers(t *testing.T) {
+	res := testAPI("GET", "/v1/openapi.json", "")
+	var spec map[string]interface{}
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &spec))
+
+	tests := []struct {
+		method   string
+		url      string
+		body     string
+		specPath string
+	}{
+		{"GET", "/v1/project/calligra/krita", "", "/v1/project/{path}"},
+		{"GET", "/v1/project/does/not/exist", "", "/v1/project/{path}"},
+		{"GET", "/v1/project/calligra/krita?jq=.%5B", "", "/v1/project/{path}"},
+		{"GET", "/v1/find?jq=%5Brange(1000000)%5D", "", "/v1/find"},
+		{"POST", "/v1/projects", `["krita", "nope"]`, "/v1/projects"},
+		{"GET", "/v1/find", "", "/v1/find"},
+		{"GET", "/v1/complete?q=kri", "", "/v1/complete"},
+		{"GET", "/v1/complete", "", "/v1/complete"},
+		{"GET", "/v1/stats?revisions=2", "", "/v1/stats"},
+		{"GET", "/v1/stats?revisions=-1", "", "/v1/stats"},
+		{"POST", "/v1/poll", "", "/v1/poll"},
+		{"GET", "/v1/poll/job", "", "/v1/poll/{id}"},
+		{"POST", "/v1/graphql", `{"query": "{ project(path: \"calligra\") { path } }"}`, "/v1/graphql"},
+		{"POST", "/v1/graphql", `{}`, "/v1/graphql"},
+		{"GET", "/v1/project/calligra/krita/dependencies", "", "/v1/project/{path}/dependencies"},
+		{"GET", "/v1/project/calligra/krita/dependencies?branchgroup=kf6", "", "/v1/project/{path}/dependencies"},
+		{"GET", "/v1/project/frameworks/solid/dependents", "", "/v1/project/{path}/dependents"},
+		{"GET", "/v1/buildorder?project=calligra/krita", "", "/v1/buildorder"},
+		{"GET", "/v1/buildorder?project=a,b", "", "/v1/buildorder"},
+		{"GET", "/v1/diff?from=abc", "", "/v1/diff"},
+		{"POST", "/v1/sql", `{"query": "SELECT 1"}`, "/v1/sql"},
+	}
+	for _, test := range tests {
+		tag := test.method + " " + test.url
+		res := testAPI(test.method, test.url, test.body)
+		entry := spec["paths"].(map[string]interface{})[test.specPath].(map[string]interface{})[strings.ToLower(test.method)]
+		responses := entry.(map[string]interface{})["responses"].(map[string]interface{})
+		response, ok := responses[strconv.Itoa(res.Code)].(map[string]interface{})
+		if !assert.True(t, ok, "undocumented status %d for %s", res.Code, tag) {
+			continue
+		}
+		content, ok := response["content"].(map[string]interface{})
+		if !ok {
+			continue // Response without body
+		}
+		schema := content["application/json"].(map[string]interface{})["schema"].(map[string]interface{})
+		var body interface{}
+		assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &body), tag)
+		assert.NoError(t, validate(spec, schema, body, "body"), tag)
+	}
+}
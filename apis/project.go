@@ -21,7 +21,11 @@
 package apis
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"anongit.kde.org/websites/api-projects-kde-org.git/models"
@@ -30,18 +34,72 @@ import (
 )
 
 type projectService interface {
-	Get(path string) (models.Project, error)
-	Find(id string, repopath string) ([]string, error)
+	Get(ctx context.Context, path models.ProjectPath) (models.Project, string, error)
+	GetMany(ctx context.Context, paths []string) (map[string]models.Project, map[string]error, string)
+	Find(ctx context.Context, id string, repopath string) ([]models.ProjectPath, error)
+	Overridden(path models.ProjectPath) []string
+	Redirect(ctx context.Context, path models.ProjectPath) (models.ProjectPath, bool)
+	Aliases(ctx context.Context, path models.ProjectPath) []models.ProjectPath
+	Suggest(ctx context.Context, path models.ProjectPath) []models.ProjectPath
+	Complete(ctx context.Context, query string, limit int) ([]models.Completion, error)
 }
 
+// Limits of completions per request.
+const (
+	completeDefaultLimit = 10
+	completeMaxLimit     = 50
+)
+
+// getManyMaxPaths is how many projects a single POST /projects may ask for.
+const getManyMaxPaths = 500
+
 type projectResource struct {
-	service projectService
+	service      projectService
+	basePath     string
+	subresources *ProjectSubresources
+}
+
+// projectSubresource handles a resource below a project, e.g.
+// /project/frameworks/solid/dependencies.
+type projectSubresource func(c *gin.Context, path models.ProjectPath)
+
+// ProjectSubresources are the resources below the projects of one router
+// group. gin cannot route below the catch-all of /project/*path so the
+// project resource dispatches them by their name suffix. Resources add
+// theirs when served, hand the same instance to ServeProjectResource.
+type ProjectSubresources struct {
+	handlers map[string]projectSubresource
+	routes   gin.RoutesInfo
 }
 
-func ServeProjectResource(rg *gin.RouterGroup, service projectService) {
-	r := &projectResource{service}
+func NewProjectSubresources() *ProjectSubresources {
+	return &ProjectSubresources{handlers: map[string]projectSubresource{}}
+}
+
+func (s *ProjectSubresources) serve(rg *gin.RouterGroup, name string, handler projectSubresource) {
+	s.handlers[name] = handler
+	s.routes = append(s.routes, gin.RouteInfo{
+		Method: http.MethodGet,
+		Path:   rg.BasePath() + "/project/*path/" + name,
+	})
+}
+
+// Routes lists the subresources the way gin lists its routes, so they can
+// be documented alongside.
+func (s *ProjectSubresources) Routes() gin.RoutesInfo {
+	return append(gin.RoutesInfo{}, s.routes...)
+}
+
+// ServeProjectResource serves the projects. subresources may be nil.
+func ServeProjectResource(rg *gin.RouterGroup, service projectService, subresources *ProjectSubresources) {
+	if subresources == nil {
+		subresources = NewProjectSubresources()
+	}
+	r := &projectResource{service, rg.BasePath(), subresources}
 	rg.GET("/project/*path", r.get)
+	rg.POST("/projects", r.getMany)
 	rg.GET("/find", r.find)
+	rg.GET("/complete", r.complete)
 }
 
 func convert(i interface{}) interface{} {
@@ -67,10 +125,38 @@ func convert(i interface{}) interface{} {
  * @apiGroup Project
  * @apiName project
  *
+ * @apiParam {String="json","yaml","csv","ndjson"} [format] Overrides the
+ *   format negotiated through the <code>Accept</code> header.
+ * @apiParam {String} [columns] Comma separated list of flattened columns for
+ *   csv output, e.g. <code>repopath,i18n.trunk_kf5</code>.
+ * @apiParam {String} [jq] jq filter applied to the JSON of the response,
+ *   e.g. <code>.i18n.stable_kf5</code>. Results are written one per line
+ *   like jq does, wrap the filter in <code>[]</code> for an array. Filters
+ *   run for at most a second and may output at most 1 MiB. <code>range</code>
+ *   and <code>repeat</code> generate at most 10000 values, strings and
+ *   arrays built take at most 16 MiB.
+ * @apiParam {Boolean} [raw] Write string results of <code>jq</code> as
+ *   plain text, like <code>jq -r</code>.
+ *
  * @apiDescription Gets the metadata of the project identified by <code>path</code>.
+ *   Available formats are <code>application/json</code>,
+ *   <code>application/x-yaml</code>, <code>text/csv</code> and
+ *   <code>application/x-ndjson</code>.
+ *   <code>urls</code> are computed from templates unless set in the metadata
+ *   of the project or one of its parents.
+ *   When additional metadata sources are configured <code>provenance</code>
+ *   maps every field to the source it came from.
+ *   Fields patched by the local overrides of the operator are listed in the
+ *   <code>X-Metadata-Overridden</code> header.
+ *   Projects that were moved are redirected to from their old paths with
+ *   <code>301 Moved Permanently</code>, the old paths are listed in
+ *   <code>aliases</code>.
+ *   When there is no project at the path the response suggests the closest
+ *   paths in <code>suggestions</code>.
  *
  * @apiSuccessExample {json} Success-Response:
  *   {
+ *   "aliases": [],
  *   "description": "Solid",
  *   "hasrepo": true,
  *   "i18n": {
@@ -85,24 +171,139 @@ func convert(i interface{}) interface{} {
  *   "projectpath": "frameworks/solid",
  *   "repoactive": true,
  *   "repopath": "solid",
- *   "type": "project"
+ *   "type": "project",
+ *   "urls": {
+ *     "apidocs": "https://api.kde.org/frameworks/solid/html/index.html",
+ *     "browse": "https://cgit.kde.org/solid.git",
+ *     "bugs": "https://bugs.kde.org/enter_bug.cgi?product=solid",
+ *     "clone": "https://anongit.kde.org/solid.git",
+ *     "push": "git@git.kde.org:solid.git"
+ *   }
  *   }
  *
+ * @apiError BadRequest Invalid or failing <code>jq</code> filter.
  * @apiError Forbidden Path may not be accessed.
+ * @apiError NotFound No project at the path.
+ * @apiErrorExample {json} NotFound-Response:
+ *   {
+ *   "error": "project not found",
+ *   "suggestions": ["calligra/krita"]
+ *   }
+ * @apiError UnprocessableEntity <code>jq</code> filter exceeded its limits.
+ * @apiError ServiceUnavailable Too many <code>jq</code> filters running,
+ *   retry after <code>Retry-After</code> seconds.
  */
 func (r *projectResource) get(c *gin.Context) {
-	path := c.Param("path")
-	if strings.Contains(path, "/..") || strings.Contains(path, "../") {
+	param := c.Param("path")
+	for name, handler := range r.subresources.handlers {
+		if !strings.HasSuffix(param, "/"+name) {
+			continue
+		}
+		path, err := models.ParseProjectPath(strings.TrimSuffix(param, "/"+name))
+		if err != nil {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		handler(c, path)
+		return
+	}
+
+	path, err := models.ParseProjectPath(param)
+	if err != nil {
 		c.AbortWithStatus(http.StatusForbidden)
 		return
 	}
 
-	response, err := r.service.Get(path)
+	ctx := c.Request.Context()
+	response, revision, err := r.service.Get(ctx, path)
+	if err == models.ErrNotFound {
+		if to, ok := r.service.Redirect(ctx, path); ok {
+			location := r.basePath + "/project/" + string(to)
+			if c.Request.URL.RawQuery != "" {
+				location += "?" + c.Request.URL.RawQuery
+			}
+			c.Redirect(http.StatusMovedPermanently, location)
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "suggestions": r.service.Suggest(ctx, path)})
+		return
+	}
+	if err == models.ErrInvalidPath {
+		// E.g. a symlink out of the projects directory.
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		panic(err)
 	}
+	setRevision(c, revision)
+	if aliases := r.service.Aliases(ctx, path); len(aliases) > 0 {
+		// The project may be cached, never write to it.
+		project := models.Project{}
+		for key, value := range response {
+			project[key] = value
+		}
+		project["aliases"] = aliases
+		response = project
+	}
+	if fields := r.service.Overridden(path); len(fields) > 0 {
+		c.Header("X-Metadata-Overridden", strings.Join(fields, ", "))
+	}
+
+	renderJQ(c, http.StatusOK, response)
+}
+
+/**
+ * @api {post} /projects Get Many
+ * @apiParam {String[]} body JSON array of project paths or repopaths, at
+ *   most 500.
+ *
+ * @apiVersion 1.0.0
+ * @apiGroup Project
+ * @apiName projects
+ *
+ * @apiDescription Gets the metadata of many projects at once. Every entry is
+ *   looked up as a path first and as a <code>repopath</code> second. All
+ *   entries are resolved from the same repo-metadata revision. Entries that
+ *   could not be resolved are listed in <code>errors</code>.
+ *
+ * @apiParamExample {json} Request-Example:
+ *   ["frameworks/solid", "krita", "does/not/exist"]
+ *
+ * @apiSuccessExample {json} Success-Response:
+ *   {
+ *   "projects": {
+ *     "frameworks/solid": { "repopath": "solid", ... },
+ *     "krita": { "repopath": "krita", ... }
+ *   },
+ *   "errors": {
+ *     "does/not/exist": "project not found"
+ *   }
+ *   }
+ *
+ * @apiError BadRequest Body is not a JSON array of strings or has more
+ *   than 500 entries.
+ */
+func (r *projectResource) getMany(c *gin.Context) {
+	var paths []string
+	if err := c.BindJSON(&paths); err != nil {
+		return // BindJSON already aborted with BadRequest
+	}
+	if len(paths) > getManyMaxPaths {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d projects per request", getManyMaxPaths)})
+		return
+	}
+
+	projects, errs, revision := r.service.GetMany(c.Request.Context(), paths)
+	setRevision(c, revision)
 
-	c.JSON(http.StatusOK, response)
+	// Entries that cannot be resolved, including paths that may not be
+	// accessed, are reported as such rather than failing the batch.
+	errStrings := map[string]string{}
+	for path, err := range errs {
+		errStrings[path] = err.Error()
+	}
+	render(c, http.StatusOK, gin.H{"projects": projects, "errors": errStrings})
 }
 
 /**
@@ -110,13 +311,24 @@ func (r *projectResource) get(c *gin.Context) {
  * @apiParam {String} id Identifier (basename) of the project to find.
  * @apiParam {String} repopath <code>repopath</code> attribute of the project
  *   to find.
+ * @apiParam {String="json","yaml","csv","ndjson"} [format] Overrides the
+ *   format negotiated through the <code>Accept</code> header.
+ * @apiParam {String} [jq] jq filter applied to the JSON of the response,
+ *   e.g. <code>.i18n.stable_kf5</code>. Results are written one per line
+ *   like jq does, wrap the filter in <code>[]</code> for an array. Filters
+ *   run for at most a second and may output at most 1 MiB. <code>range</code>
+ *   and <code>repeat</code> generate at most 10000 values, strings and
+ *   arrays built take at most 16 MiB.
+ * @apiParam {Boolean} [raw] Write string results of <code>jq</code> as
+ *   plain text, like <code>jq -r</code>.
  *
  * @apiVersion 1.0.0
  * @apiGroup Project
  * @apiName find
  *
  * @apiDescription Finds matching projects by a combination of filter params or
- *   none to list all projects.
+ *   none to list all projects. csv and ndjson output have one
+ *   <code>path</code> record per project.
  *
  * @apiSuccessExample {json} Success-Response:
  *   [
@@ -125,16 +337,80 @@ func (r *projectResource) get(c *gin.Context) {
  *   "calligra",
  *   ...
  *   ]
+ *
+ * @apiError BadRequest Invalid or failing <code>jq</code> filter.
+ * @apiError Forbidden A matching path may not be accessed.
+ * @apiError NotFound Nothing matched.
+ * @apiError UnprocessableEntity <code>jq</code> filter exceeded its limits.
+ * @apiError ServiceUnavailable Too many <code>jq</code> filters running,
+ *   retry after <code>Retry-After</code> seconds.
  */
 func (r *projectResource) find(c *gin.Context) {
 	id := c.Query("id")
 	repopath := c.Query("repopath")
 
-	matches, err := r.service.Find(id, repopath)
-
+	matches, err := r.service.Find(c.Request.Context(), id, repopath)
+	if err == models.ErrInvalidPath {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
 	if len(matches) == 0 || err != nil {
 		c.AbortWithStatus(http.StatusNotFound)
 		return
 	}
-	c.JSON(http.StatusOK, matches)
+	renderJQ(c, http.StatusOK, matches)
+}
+
+/**
+ * @api {get} /complete Complete
+ * @apiParam {String} q What was typed so far.
+ * @apiParam {Number} [limit=10] Maximum number of completions, at most 50.
+ *
+ * @apiVersion 1.0.0
+ * @apiGroup Project
+ * @apiName complete
+ *
+ * @apiDescription Completes project paths, names and repopaths for
+ *   typeahead. Matching is case insensitive. Prefixes, of the path or any of
+ *   its segments, rank before substrings, which rank before fuzzy matches
+ *   that merely contain the typed characters in order. <code>field</code>
+ *   is what matched best, <code>match</code> how.
+ *
+ * @apiSuccessExample {json} Success-Response:
+ *   [
+ *   {
+ *     "path": "calligra/krita",
+ *     "name": "Krita",
+ *     "repopath": "krita",
+ *     "field": "name",
+ *     "match": "prefix"
+ *   }
+ *   ]
+ *
+ * @apiError BadRequest <code>q</code> is missing or <code>limit</code> out
+ *   of range.
+ */
+func (r *projectResource) complete(c *gin.Context) {
+	query := c.Query("q")
+	limit := completeDefaultLimit
+	var err error
+	if query == "" {
+		err = errors.New("missing q")
+	}
+	if value := c.Query("limit"); err == nil && value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > completeMaxLimit {
+			err = fmt.Errorf("limit must be between 1 and %d", completeMaxLimit)
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	completions, err := r.service.Complete(c.Request.Context(), query, limit)
+	if err != nil {
+		panic(err)
+	}
+	render(c, http.StatusOK, completions)
 }
@@ -21,14 +21,23 @@
 package apis
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 
 	"anongit.kde.org/websites/api-projects-kde-org.git/apis"
 	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/stretchr/testify/assert"
 )
 
+// Revision the double reads its data at. It differs from the one of the
+// RevisionService double as if an update landed in between.
+const dataRevision = "abc124"
+
 // Test Double
 type ProjectService struct {
 }
@@ -37,17 +46,86 @@ func NewProjectService() *ProjectService {
 	return &ProjectService{}
 }
 
-func (s *ProjectService) Get(path string) (models.Project, error) {
+func (s *ProjectService) Get(ctx context.Context, path models.ProjectPath) (models.Project, string, error) {
 	project := models.Project{}
-	if path == "/calligra/krita" {
+	if path == "calligra/krita" {
 		project["repopath"] = "krita"
-		return project, nil
+		return project, dataRevision, nil
+	}
+	if path == "frameworks/solid" {
+		project["repopath"] = "solid"
+		return project, dataRevision, nil
+	}
+	if path == "does/not/exist" || path == "kdelibs/solid" || path == "calligra/kirta" {
+		return nil, dataRevision, models.ErrNotFound
+	}
+	if path == "calligra/escape" {
+		return nil, dataRevision, models.ErrInvalidPath
+	}
+	return project, "", errors.New("unexpected path " + path.String())
+}
+
+func (s *ProjectService) GetMany(ctx context.Context, paths []string) (map[string]models.Project, map[string]error, string) {
+	projects := map[string]models.Project{}
+	errs := map[string]error{}
+	for _, path := range paths {
+		if path == "krita" || path == "calligra/krita" {
+			projects[path] = models.Project{"repopath": "krita"}
+			continue
+		}
+		if path == "calligra/escape" {
+			errs[path] = models.ErrInvalidPath
+			continue
+		}
+		errs[path] = errors.New("project not found")
+	}
+	return projects, errs, dataRevision
+}
+
+func (s *ProjectService) Overridden(path models.ProjectPath) []string {
+	if path == "calligra/krita" {
+		return []string{"repoactive"}
+	}
+	return []string{}
+}
+
+func (s *ProjectService) Redirect(ctx context.Context, path models.ProjectPath) (models.ProjectPath, bool) {
+	if path == "kdelibs/solid" {
+		return "frameworks/solid", true
 	}
-	return project, errors.New("unexpected path " + path)
+	return "", false
 }
 
-func (s *ProjectService) Find(id string, repopath string) ([]string, error) {
-	projects := []string{"calligra/krita"}
+func (s *ProjectService) Aliases(ctx context.Context, path models.ProjectPath) []models.ProjectPath {
+	if path == "frameworks/solid" {
+		return []models.ProjectPath{"kdelibs/solid"}
+	}
+	return []models.ProjectPath{}
+}
+
+func (s *ProjectService) Suggest(ctx context.Context, path models.ProjectPath) []models.ProjectPath {
+	if path == "calligra/kirta" {
+		return []models.ProjectPath{"calligra/krita"}
+	}
+	return []models.ProjectPath{}
+}
+
+func (s *ProjectService) Complete(ctx context.Context, query string, limit int) ([]models.Completion, error) {
+	completions := []models.Completion{
+		{Path: "calligra/krita", Name: "Krita", Repopath: "krita", Field: "name", Match: "prefix"},
+		{Path: "frameworks/kirigami", Name: "Kirigami", Field: "name", Match: "fuzzy"},
+	}
+	if query != "kri" {
+		return []models.Completion{}, nil
+	}
+	if limit < len(completions) {
+		completions = completions[:limit]
+	}
+	return completions, nil
+}
+
+func (s *ProjectService) Find(ctx context.Context, id string, repopath string) ([]models.ProjectPath, error) {
+	projects := []models.ProjectPath{"calligra/krita"}
 	if id == "krita" && repopath == "" {
 		return projects, nil
 	}
@@ -57,21 +135,139 @@ func (s *ProjectService) Find(id string, repopath string) ([]string, error) {
 	if id == "" && repopath == "" {
 		return append(projects, "frameworks/solid"), nil
 	}
+	if id == "escape" {
+		return nil, models.ErrInvalidPath
+	}
 	panic("unexpected query")
 }
 
 func init() {
 	v1 := router.Group("/v1")
 	{
-		apis.ServeProjectResource(v1, NewProjectService())
+		apis.ServeProjectResource(v1, NewProjectService(), subresources)
 	}
 }
 
 func TestProject(t *testing.T) {
 	runAPITests(t, []apiTestCase{
 		{"t1 - get a project", "GET", "/v1/project/calligra/krita", "", http.StatusOK, `{"repopath":"krita"}`},
+		{"t1 - get an encoded traversal", "GET", "/v1/project/%252e%252e/calligra/krita", "", http.StatusForbidden, ""},
+		{"t1 - get a missing project", "GET", "/v1/project/does/not/exist", "", http.StatusNotFound, `{"error": "project not found", "suggestions": []}`},
+		{"t1 - get a misspelled project", "GET", "/v1/project/calligra/kirta", "", http.StatusNotFound,
+			`{"error": "project not found", "suggestions": ["calligra/krita"]}`},
+		{"t1 - get with redundant slashes", "GET", "/v1/project/calligra//krita/", "", http.StatusOK, `{"repopath":"krita"}`},
 		{"t2 - find by id", "GET", "/v1/find?id=krita", "", http.StatusOK, `["calligra/krita"]`},
 		{"t3 - find by repopath", "GET", "/v1/find?repopath=krita", "", http.StatusOK, `["calligra/krita"]`},
 		{"t4 - find all", "GET", "/v1/find", "", http.StatusOK, `["calligra/krita", "frameworks/solid"]`},
+		{"t5 - get many", "POST", "/v1/projects", `["calligra/krita", "krita", "nope"]`, http.StatusOK,
+			`{"projects": {"calligra/krita": {"repopath": "krita"}, "krita": {"repopath": "krita"}}, "errors": {"nope": "project not found"}}`},
+		{"t6 - get many with bad body", "POST", "/v1/projects", `{"x": 1}`, http.StatusBadRequest, ""},
+		{"t7 - get an escaping project", "GET", "/v1/project/calligra/escape", "", http.StatusForbidden, ""},
+		{"t8 - find an escaping project", "GET", "/v1/find?id=escape", "", http.StatusForbidden, ""},
+		{"t9 - get many with an escaping project", "POST", "/v1/projects", `["krita", "calligra/escape"]`, http.StatusOK,
+			`{"projects": {"krita": {"repopath": "krita"}}, "errors": {"calligra/escape": "invalid project path"}}`},
+		{"t10 - get too many", "POST", "/v1/projects", `[` + strings.Repeat(`"krita", `, 500) + `"krita"]`, http.StatusBadRequest,
+			`{"error": "at most 500 projects per request"}`},
+	})
+}
+
+func TestProjectOverridden(t *testing.T) {
+	res := testAPI("GET", "/v1/project/calligra/krita", "")
+	assert.Equal(t, "repoactive", res.Header().Get("X-Metadata-Overridden"))
+}
+
+func TestProjectRedirect(t *testing.T) {
+	res := testAPI("GET", "/v1/project/kdelibs/solid?format=yaml", "")
+	assert.Equal(t, http.StatusMovedPermanently, res.Code)
+	assert.Equal(t, "/v1/project/frameworks/solid?format=yaml", res.Header().Get("Location"))
+
+	runAPITests(t, []apiTestCase{
+		{"t1 - get with aliases", "GET", "/v1/project/frameworks/solid", "", http.StatusOK,
+			`{"repopath":"solid","aliases":["kdelibs/solid"]}`},
+		{"t2 - no redirect for missing projects", "GET", "/v1/project/does/not/exist", "", http.StatusNotFound, ""},
+	})
+}
+
+func TestProjectComplete(t *testing.T) {
+	runAPITests(t, []apiTestCase{
+		{"t1 - complete", "GET", "/v1/complete?q=kri", "", http.StatusOK,
+			`[{"path": "calligra/krita", "name": "Krita", "repopath": "krita", "field": "name", "match": "prefix"},
+			{"path": "frameworks/kirigami", "name": "Kirigami", "field": "name", "match": "fuzzy"}]`},
+		{"t2 - complete with limit", "GET", "/v1/complete?q=kri&limit=1", "", http.StatusOK,
+			`[{"path": "calligra/krita", "name": "Krita", "repopath": "krita", "field": "name", "match": "prefix"}]`},
+		{"t3 - nothing matches", "GET", "/v1/complete?q=zzz", "", http.StatusOK, `[]`},
+		{"t4 - missing q", "GET", "/v1/complete", "", http.StatusBadRequest, `{"error": "missing q"}`},
+		{"t5 - limit out of range", "GET", "/v1/complete?q=kri&limit=51", "", http.StatusBadRequest,
+			`{"error": "limit must be between 1 and 50"}`},
+	})
+}
+
+func TestProjectFormats(t *testing.T) {
+	runAPITests(t, []apiTestCase{
+		{"t1 - yaml by query", "GET", "/v1/project/calligra/krita?format=yaml", "", http.StatusOK, ""},
+		{"t2 - unknown format", "GET", "/v1/project/calligra/krita?format=xml", "", http.StatusNotAcceptable, ""},
+		{"t3 - csv of get many", "POST", "/v1/projects?format=csv", `["krita"]`, http.StatusNotAcceptable, ""},
 	})
+
+	res := testAPIWithAccept("GET", "/v1/project/calligra/krita", "application/x-yaml")
+	assert.Equal(t, "repopath: krita\n", res.Body.String())
+	assert.Equal(t, "application/x-yaml; charset=utf-8", res.Header().Get("Content-Type"))
+
+	res = testAPIWithAccept("GET", "/v1/find?columns=path", "text/csv")
+	assert.Equal(t, "path\ncalligra/krita\nframeworks/solid\n", res.Body.String())
+
+	res = testAPIWithAccept("GET", "/v1/project/calligra/krita?format=csv", "")
+	assert.Equal(t, "repopath\nkrita\n", res.Body.String())
+
+	res = testAPIWithAccept("GET", "/v1/find", "application/x-ndjson")
+	assert.Equal(t, "{\"path\":\"calligra/krita\"}\n{\"path\":\"frameworks/solid\"}\n", res.Body.String())
+
+	res = testAPIWithAccept("GET", "/v1/find", "image/png")
+	assert.Equal(t, http.StatusNotAcceptable, res.Code)
+}
+
+func TestProjectJQ(t *testing.T) {
+	runAPITests(t, []apiTestCase{
+		{"t1 - field", "GET", "/v1/project/calligra/krita?jq=.repopath", "", http.StatusOK, `"krita"`},
+		{"t2 - collected", "GET", "/v1/find?jq=%5B.%5B%5D%7Csplit(%22/%22)%5B0%5D%5D", "", http.StatusOK, `["calligra", "frameworks"]`},
+		{"t3 - syntax error", "GET", "/v1/project/calligra/krita?jq=.%5B", "", http.StatusBadRequest, ""},
+		{"t4 - runtime error", "GET", "/v1/project/calligra/krita?jq=.repopath.x", "", http.StatusBadRequest, ""},
+		{"t5 - endless", "GET", "/v1/project/calligra/krita?jq=last(repeat(1))", "", http.StatusUnprocessableEntity, ""},
+		{"t6 - too much output", "GET", "/v1/project/calligra/krita?jq=%5Brange(60000)%7C%22xxxxxxxxxxxxxxxxxxxx%22%5D", "", http.StatusUnprocessableEntity, ""},
+		{"t7 - environment", "GET", "/v1/project/calligra/krita?jq=%24ENV", "", http.StatusOK, `{}`},
+		{"t8 - bounded range", "GET", "/v1/project/calligra/krita?jq=%5Brange(1%3B7%3B2)%5D", "", http.StatusOK, `[1, 3, 5]`},
+		{"t9 - bounded repeat", "GET", "/v1/project/calligra/krita?jq=%5Blimit(3%3Brepeat(1))%5D", "", http.StatusOK, `[1, 1, 1]`},
+		{"t10 - multiplication", "GET", "/v1/project/calligra/krita?jq=.repopath*2", "", http.StatusOK, `"kritakrita"`},
+		{"t11 - merge", "GET", "/v1/project/calligra/krita?jq=%7Ba%3A%7Bb%3A1%7D%7D*%7Ba%3A%7Bc%3A2%7D%7D", "", http.StatusOK, `{"a": {"b": 1, "c": 2}}`},
+		{"t12 - internals", "GET", "/v1/project/calligra/krita?jq=%5B_range(0%3B3%3B1)%5D", "", http.StatusBadRequest, ""},
+		{"t13 - addition", "GET", "/v1/project/calligra/krita?jq=%5B.repopath%2B%22.git%22%2C(%5B1%2C2%5D%7Cadd)%5D", "", http.StatusOK, `["krita.git", 3]`},
+		{"t14 - join", "GET", "/v1/find?jq=join(%22%2C%22)", "", http.StatusOK, `"calligra/krita,frameworks/solid"`},
+	})
+
+	jqBuilt := "jq filter builds more than 16777216 bytes of strings and arrays"
+	for filter, message := range map[string]string{
+		"[range(1000000)]":                                  "range exceeds 10000 values",
+		"[range(0; 1e9; 2)]":                                "range exceeds 10000 values",
+		"[limit(20000; repeat(1))]":                         "repeat exceeds 10000 values",
+		`"x" * 100000000`:                                   jqBuilt,
+		`.repopath *= 100000000`:                            jqBuilt,
+		`[.repopath] | map(100000000 * .)`:                  jqBuilt,
+		`reduce range(28) as $i ("x"; . + .) | length`:      jqBuilt,
+		`reduce range(28) as $i ([1]; . + .) | length`:      jqBuilt,
+		`reduce range(28) as $i ("x"; . += .)`:              jqBuilt,
+		`reduce range(28) as $i ("x"; [., .] | add)`:        jqBuilt,
+		`reduce range(28) as $i ("x"; [., .] | join(.[0]))`: jqBuilt,
+	} {
+		res := testAPI("GET", "/v1/project/calligra/krita?jq="+url.QueryEscape(filter), "")
+		assert.Equal(t, http.StatusUnprocessableEntity, res.Code, filter)
+		assert.Contains(t, res.Body.String(), message, filter)
+	}
+
+	res := testAPI("GET", "/v1/find?jq=.%5B%5D", "")
+	assert.Equal(t, "\"calligra/krita\"\n\"frameworks/solid\"\n", res.Body.String())
+	assert.Equal(t, "application/x-ndjson; charset=utf-8", res.Header().Get("Content-Type"))
+
+	res = testAPI("GET", "/v1/find?jq=.%5B%5D&raw=true", "")
+	assert.Equal(t, "calligra/krita\nframeworks/solid\n", res.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", res.Header().Get("Content-Type"))
 }
@@ -0,0 +1,146 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit configures a token bucket. A client may do Burst requests at
+// once and gains another one every Interval. A zero Interval disables
+// limiting.
+type RateLimit struct {
+	Interval time.Duration
+	Burst    int
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type rateLimiter struct {
+	limit     RateLimit
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	mutex     sync.Mutex
+	now       func() time.Time
+}
+
+// RateLimiter returns a middleware limiting every client to its own token
+// bucket. Clients are told about their budget through the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers, rejected requests
+// additionally get a Retry-After.
+// Every call creates a separate budget, so a group of routes may get a
+// stricter limit on top of the general one. It relies on Authenticate
+// running before it to tell clients with a token apart.
+func RateLimiter(limit RateLimit) gin.HandlerFunc {
+	l := &rateLimiter{
+		limit:   limit,
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+	return l.handle
+}
+
+// clientKey identifies the client by the token Authenticate verified, by
+// its address otherwise. Made up tokens must not buy fresh budgets.
+func clientKey(c *gin.Context) string {
+	if value, ok := c.Get(tokenKey); ok {
+		return "token:" + value.(models.Token).Hash
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// take refills the bucket of key and takes a token from it if there is one.
+// It returns the tokens left and how long until the next token.
+func (l *rateLimiter) take(key string) (bool, float64, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{float64(l.limit.Burst), now}
+		l.buckets[key] = b
+	}
+	b.tokens += float64(now.Sub(b.updated)) / float64(l.limit.Interval)
+	b.tokens = math.Min(b.tokens, float64(l.limit.Burst))
+	b.updated = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) * float64(l.limit.Interval))
+		return false, b.tokens, wait
+	}
+	b.tokens--
+	return true, b.tokens, 0
+}
+
+// sweep forgets clients whose buckets have refilled. Those are
+// indistinguishable from new clients.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	full := time.Duration(l.limit.Burst) * l.limit.Interval
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// seconds rounds up, headers carry whole seconds.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+func (l *rateLimiter) handle(c *gin.Context) {
+	if l.limit.Interval <= 0 {
+		c.Next()
+		return
+	}
+
+	ok, tokens, wait := l.take(clientKey(c))
+	untilFull := time.Duration((float64(l.limit.Burst) - tokens) * float64(l.limit.Interval))
+	c.Header("RateLimit-Limit", strconv.Itoa(l.limit.Burst))
+	c.Header("RateLimit-Remaining", strconv.Itoa(int(tokens)))
+	c.Header("RateLimit-Reset", seconds(untilFull))
+	if !ok {
+		c.Header("Cache-Control", "no-store")
+		c.Header("Retry-After", seconds(wait))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests,
+			fmt.Sprintf("Rate limit exceeded. Retry in %ss.", seconds(wait)))
+		return
+	}
+	c.Next()
+}
@@ -0,0 +1,84 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/apis"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	limited := router.Group("/limited", apis.Authenticate(NewAuthService()),
+		apis.RateLimiter(apis.RateLimit{Interval: time.Hour, Burst: 2}))
+	{
+		limited.GET("/ping", func(c *gin.Context) { c.JSON(http.StatusOK, "pong") })
+		admin := limited.Group("", apis.RateLimiter(apis.RateLimit{Interval: time.Hour, Burst: 1}))
+		admin.GET("/admin", func(c *gin.Context) { c.JSON(http.StatusOK, "done") })
+	}
+	unlimited := router.Group("/unlimited", apis.RateLimiter(apis.RateLimit{}))
+	{
+		unlimited.GET("/ping", func(c *gin.Context) { c.JSON(http.StatusOK, "pong") })
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	res := testAPIWithToken("GET", "/limited/ping", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "2", res.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", res.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "3600", res.Header().Get("RateLimit-Reset"))
+	assert.Empty(t, res.Header().Get("Retry-After"))
+
+	// The admin budget is separate, but also counts against the general one.
+	res = testAPIWithToken("GET", "/limited/admin", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "1", res.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", res.Header().Get("RateLimit-Remaining"))
+
+	res = testAPIWithToken("GET", "/limited/ping", "")
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.Equal(t, "0", res.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "3600", res.Header().Get("Retry-After"))
+
+	// Clients with a token have their own budget.
+	res = testAPIWithToken("GET", "/limited/admin", "reader")
+	assert.Equal(t, http.StatusOK, res.Code)
+	res = testAPIWithToken("GET", "/limited/admin", "reader")
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.Equal(t, "1", res.Header().Get("RateLimit-Limit"))
+
+	// Made up tokens get none.
+	res = testAPIWithToken("GET", "/limited/ping", "made-up")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Empty(t, res.Header().Get("RateLimit-Limit"))
+
+	for i := 0; i < 5; i++ {
+		res = testAPIWithToken("GET", "/unlimited/ping", "")
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Empty(t, res.Header().Get("RateLimit-Limit"))
+	}
+}
@@ -0,0 +1,167 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits of SQL queries. Statements running longer are interrupted.
+const (
+	sqlTimeout     = 5 * time.Second
+	sqlDefaultRows = 1000
+	sqlMaxRows     = 10000
+)
+
+type sqlService interface {
+	Query(ctx context.Context, query string, maxRows int) (*models.QueryResult, error)
+	Dump(ctx context.Context) ([]byte, string, error)
+}
+
+type sqlResource struct {
+	service sqlService
+}
+
+func ServeSQLResource(rg *gin.RouterGroup, service sqlService) {
+	r := &sqlResource{service}
+	rg.GET("/sql", RequireScope(models.ScopeRead), r.query)
+	rg.POST("/sql", RequireScope(models.ScopeRead), r.query)
+	rg.GET("/sql/metadata.sqlite", RequireScope(models.ScopeRead), r.dump)
+}
+
+type sqlRequest struct {
+	Query string `json:"query" form:"query"`
+	Limit int    `json:"limit" form:"limit"`
+}
+
+/**
+ * @api {post} /sql SQL
+ * @apiHeader {String} Authorization <code>Bearer</code> token with the
+ *   <code>read</code> scope.
+ * @apiParam {String} query SQLite statement, only reading ones are allowed.
+ * @apiParam {Number} [limit=1000] Maximum number of rows, at most 10000. 0
+ *   is the default.
+ *
+ * @apiVersion 1.0.0
+ * @apiGroup Project
+ * @apiName sql
+ *
+ * @apiDescription Queries a SQLite database of the resolved projects of the
+ *   served revision. Queries may also be sent as GET with
+ *   <code>query</code> and <code>limit</code> parameters. Statements are
+ *   interrupted after 5 seconds. The schema is:
+ *   <pre>
+ *   meta (key, value) -- key revision
+ *   projects (path, toplevel, name, description, icon, type, repopath,
+ *             hasrepo, repoactive, json)
+ *   i18n (path, key, value)
+ *   members (path, username, displayname, email, json)
+ *   </pre>
+ *
+ * @apiParamExample {json} Request-Example:
+ *   { "query": "SELECT toplevel, count(*) FROM projects p WHERE repoactive AND NOT EXISTS (SELECT 1 FROM i18n WHERE path = p.path AND key = 'trunk_kf5' AND value != 'none') GROUP BY toplevel" }
+ *
+ * @apiSuccessExample {json} Success-Response:
+ *   {
+ *     "revision": "9d41e7c3b2...",
+ *     "columns": ["toplevel", "count(*)"],
+ *     "rows": [["extragear", 12], ["playground", 40]],
+ *     "truncated": false
+ *   }
+ *
+ * @apiError BadRequest Query is missing, invalid or would write, or its
+ *   result exceeds 8 MiB.
+ * @apiError Unauthorized No or an unknown token.
+ * @apiError Forbidden Token lacks the <code>read</code> scope.
+ * @apiError UnprocessableEntity Query ran out of time.
+ */
+func (r *sqlResource) query(c *gin.Context) {
+	var request sqlRequest
+	var err error
+	if c.Request.Method == "POST" {
+		err = c.ShouldBindJSON(&request)
+	} else {
+		err = c.ShouldBindQuery(&request)
+	}
+	if err == nil && request.Query == "" {
+		err = errors.New("missing query")
+	}
+	if err == nil && (request.Limit < 0 || request.Limit > sqlMaxRows) {
+		err = fmt.Errorf("limit must be between 0 and %d, 0 is the default of %d", sqlMaxRows, sqlDefaultRows)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Limit == 0 {
+		request.Limit = sqlDefaultRows
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), sqlTimeout)
+	defer cancel()
+	result, err := r.service.Query(ctx, request.Query, request.Limit)
+	var queryErr *models.QueryError
+	switch {
+	case errors.As(err, &queryErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err == context.DeadlineExceeded:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "query timed out after " + sqlTimeout.String()})
+		return
+	case err != nil:
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	render(c, http.StatusOK, result)
+}
+
+/**
+ * @api {get} /sql/metadata.sqlite SQLite Database
+ * @apiHeader {String} Authorization <code>Bearer</code> token with the
+ *   <code>read</code> scope.
+ *
+ * @apiVersion 1.0.0
+ * @apiGroup Project
+ * @apiName sqlDump
+ *
+ * @apiDescription Downloads the SQLite database /sql queries, for the
+ *   served revision.
+ *
+ * @apiError Unauthorized No or an unknown token.
+ * @apiError Forbidden Token lacks the <code>read</code> scope.
+ */
+func (r *sqlResource) dump(c *gin.Context) {
+	data, revision, err := r.service.Dump(c.Request.Context())
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="repo-metadata-%s.sqlite"`, revision))
+	c.Data(http.StatusOK, "application/vnd.sqlite3", data)
+}
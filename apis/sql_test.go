@@ -0,0 +1,100 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/apis"
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test Double
+type SQLService struct {
+}
+
+func (s *SQLService) Query(ctx context.Context, query string, maxRows int) (*models.QueryResult, error) {
+	switch query {
+	case "slow":
+		<-ctx.Done()
+		return nil, context.DeadlineExceeded
+	case "bad":
+		return nil, &models.QueryError{Message: "attempt to write a readonly database"}
+	}
+	return &models.QueryResult{Revision: "abc", Columns: []string{"query", "limit"},
+		Rows: [][]interface{}{{query, maxRows}}}, nil
+}
+
+func (s *SQLService) Dump(ctx context.Context) ([]byte, string, error) {
+	return []byte("SQLite format 3\x00"), "abc", nil
+}
+
+func init() {
+	v1 := router.Group("/v1", apis.Authenticate(NewAuthService()))
+	{
+		apis.ServeSQLResource(v1, &SQLService{})
+	}
+}
+
+func TestSQL(t *testing.T) {
+	runAPITests(t, []apiTestCase{
+		{"t1 - anonymous", "GET", "/v1/sql?query=SELECT+1", "", http.StatusUnauthorized, ""},
+		{"t2 - anonymous post", "POST", "/v1/sql", `{"query": "SELECT 1"}`, http.StatusUnauthorized, ""},
+		{"t3 - anonymous download", "GET", "/v1/sql/metadata.sqlite", "", http.StatusUnauthorized, ""},
+	})
+
+	res := testAPIWithToken("GET", "/v1/sql?query=SELECT+1", "reader")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"revision": "abc", "columns": ["query", "limit"], "rows": [["SELECT 1", 1000]], "truncated": false}`,
+		res.Body.String())
+
+	res = testAPIWithToken("GET", "/v1/sql?query=SELECT+1&limit=5", "reader")
+	assert.JSONEq(t, `{"revision": "abc", "columns": ["query", "limit"], "rows": [["SELECT 1", 5]], "truncated": false}`,
+		res.Body.String())
+
+	res = testAPIWithToken("GET", "/v1/sql?query=SELECT+1&limit=0", "reader")
+	assert.JSONEq(t, `{"revision": "abc", "columns": ["query", "limit"], "rows": [["SELECT 1", 1000]], "truncated": false}`,
+		res.Body.String())
+
+	res = testAPIWithToken("GET", "/v1/sql?query=SELECT+1&limit=100000", "reader")
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.JSONEq(t, `{"error": "limit must be between 0 and 10000, 0 is the default of 1000"}`, res.Body.String())
+
+	res = testAPIWithToken("GET", "/v1/sql", "reader")
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.JSONEq(t, `{"error": "missing query"}`, res.Body.String())
+
+	res = testAPIWithToken("GET", "/v1/sql?query=bad", "reader")
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.JSONEq(t, `{"error": "attempt to write a readonly database"}`, res.Body.String())
+
+	res = testAPIWithToken("GET", "/v1/sql?query=SELECT+1", "poller")
+	assert.Equal(t, http.StatusForbidden, res.Code)
+
+	res = testAPIWithToken("GET", "/v1/sql/metadata.sqlite", "reader")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/vnd.sqlite3", res.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="repo-metadata-abc.sqlite"`, res.Header().Get("Content-Disposition"))
+}
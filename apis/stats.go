@@ -0,0 +1,125 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Revisions in the series of stats. Resolving an old revision the first time
+// is about as expensive as a diff, so there are not too many, and fewer
+// still for clients without a token.
+const (
+	statsDefaultRevisions      = 10
+	statsMaxRevisions          = 50
+	statsAnonymousMaxRevisions = 10
+)
+
+type statsService interface {
+	Stats(ctx context.Context, revisions int) (*models.StatsReport, error)
+}
+
+type statsResource struct {
+	service statsService
+}
+
+func ServeStatsResource(rg *gin.RouterGroup, service statsService) {
+	r := &statsResource{service}
+	rg.GET("/stats", r.stats)
+}
+
+/**
+ * @api {get} /stats Stats
+ * @apiParam {Number} [revisions=10] Number of recent revisions in
+ *   <code>series</code>, at most 50 with a token and 10 without. 0 leaves
+ *   the series empty.
+ *
+ * @apiVersion 1.0.0
+ * @apiGroup Project
+ * @apiName stats
+ *
+ * @apiDescription Aggregates over the projects of the served revision in
+ *   <code>current</code>: counts by top level group and
+ *   <code>type</code>, projects with and without a repository, active and
+ *   inactive repositories, the resolved i18n branches by key and projects
+ *   without members. <code>series</code> has the same aggregates for the
+ *   most recent revisions of repo-metadata, newest first. Like diffs they
+ *   are resolved from repo-metadata alone, additional metadata sources and
+ *   overrides do not apply.
+ *
+ * @apiSuccessExample {json} Success-Response:
+ *   {
+ *   "current": {
+ *     "revision": "9d41e7c3b2...",
+ *     "revision_time": "2017-10-12T09:21:07Z",
+ *     "projects": 1210,
+ *     "groups": {
+ *       "frameworks": { "component": 1, "project": 79 },
+ *       ...
+ *     },
+ *     "hasrepo": 1102,
+ *     "without_repo": 108,
+ *     "active_repos": 1001,
+ *     "inactive_repos": 101,
+ *     "i18n": {
+ *       "trunk_kf5": { "master": 690, "none": 520 },
+ *       ...
+ *     },
+ *     "without_members": 1210
+ *   },
+ *   "series": [
+ *     { "revision": "9d41e7c3b2...", ... },
+ *     { "revision": "5f1c08aa91...", ... }
+ *   ]
+ *   }
+ *
+ * @apiError BadRequest <code>revisions</code> out of range.
+ */
+func (r *statsResource) stats(c *gin.Context) {
+	revisions := statsDefaultRevisions
+	maxRevisions, hint := statsMaxRevisions, ""
+	if _, ok := c.Get(tokenKey); !ok {
+		maxRevisions, hint = statsAnonymousMaxRevisions, " without a token"
+	}
+	if value := c.Query("revisions"); value != "" {
+		var err error
+		revisions, err = strconv.Atoi(value)
+		if err != nil || revisions < 0 || revisions > maxRevisions {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("revisions must be between 0 and %d%s", maxRevisions, hint),
+			})
+			return
+		}
+	}
+
+	report, err := r.service.Stats(c.Request.Context(), revisions)
+	if err != nil {
+		panic(err)
+	}
+	render(c, http.StatusOK, report)
+}
@@ -0,0 +1,88 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package apis
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/apis"
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test Double
+type StatsService struct {
+}
+
+func (s *StatsService) Stats(ctx context.Context, revisions int) (*models.StatsReport, error) {
+	stats := models.Stats{
+		Revision:       "def",
+		RevisionTime:   time.Date(2017, 10, 12, 9, 21, 7, 0, time.UTC),
+		Projects:       2,
+		Groups:         map[string]map[string]int{"calligra": {"project": 1, "component": 1}},
+		HasRepo:        1,
+		WithoutRepo:    1,
+		ActiveRepos:    1,
+		I18n:           map[string]map[string]int{"trunk_kf5": {"master": 1, "none": 1}},
+		WithoutMembers: 2,
+	}
+	report := &models.StatsReport{Current: stats, Series: []models.Stats{}}
+	for i := 0; i < revisions; i++ {
+		report.Series = append(report.Series, stats)
+	}
+	return report, nil
+}
+
+func init() {
+	v1 := router.Group("/v1", apis.Authenticate(NewAuthService()))
+	{
+		apis.ServeStatsResource(v1, &StatsService{})
+	}
+}
+
+func TestStats(t *testing.T) {
+	current := `{
+		"revision": "def", "revision_time": "2017-10-12T09:21:07Z", "projects": 2,
+		"groups": {"calligra": {"project": 1, "component": 1}},
+		"hasrepo": 1, "without_repo": 1, "active_repos": 1, "inactive_repos": 0,
+		"i18n": {"trunk_kf5": {"master": 1, "none": 1}}, "without_members": 2
+	}`
+	runAPITests(t, []apiTestCase{
+		{"t1 - stats", "GET", "/v1/stats?revisions=1", "", http.StatusOK,
+			`{"current": ` + current + `, "series": [` + current + `]}`},
+		{"t2 - without series", "GET", "/v1/stats?revisions=0", "", http.StatusOK,
+			`{"current": ` + current + `, "series": []}`},
+		{"t3 - too many revisions", "GET", "/v1/stats?revisions=11", "", http.StatusBadRequest,
+			`{"error": "revisions must be between 0 and 10 without a token"}`},
+		{"t4 - bad revisions", "GET", "/v1/stats?revisions=x", "", http.StatusBadRequest,
+			`{"error": "revisions must be between 0 and 10 without a token"}`},
+	})
+
+	res := testAPIWithToken("GET", "/v1/stats?revisions=50", "reader")
+	assert.Equal(t, http.StatusOK, res.Code)
+	res = testAPIWithToken("GET", "/v1/stats?revisions=51", "reader")
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.JSONEq(t, `{"error": "revisions must be between 0 and 50"}`, res.Body.String())
+}
@@ -0,0 +1,133 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+	"anongit.kde.org/websites/api-projects-kde-org.git/services"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Commands querying a local checkout run against the same services as the
+// server, without starting it.
+
+func addFormatFlag(fs *flag.FlagSet) *string {
+	return fs.String("format", "json", "output format, json or yaml")
+}
+
+func printData(w io.Writer, format string, data interface{}) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(data)
+	case "yaml":
+		out, err := yaml.Marshal(data)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(out)
+		return err
+	}
+	return fmt.Errorf("unknown format %s", format)
+}
+
+// get prints the project at a path.
+func get(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	metadata := addMetadataFlags(fs, "warn")
+	format := addFormatFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: get [flags] <path>")
+	}
+	path, err := models.ParseProjectPath(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	service := services.NewProjectService(metadata.newGitDAO(false, metadata.newLogger()))
+	project, _, err := service.Get(context.Background(), path)
+	if err != nil {
+		return err
+	}
+	return printData(stdout, *format, project)
+}
+
+// find prints the paths of matching projects.
+func find(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("find", flag.ExitOnError)
+	metadata := addMetadataFlags(fs, "warn")
+	format := addFormatFlag(fs)
+	id := fs.String("id", "", "identifier (basename) of the projects to find")
+	repopath := fs.String("repopath", "", "repopath of the projects to find")
+	fs.Parse(args)
+
+	service := services.NewProjectService(metadata.newGitDAO(false, metadata.newLogger()))
+	paths, err := service.Find(context.Background(), *id, *repopath)
+	if err != nil {
+		return err
+	}
+	return printData(stdout, *format, paths)
+}
+
+// dump prints all projects keyed by path.
+func dump(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	metadata := addMetadataFlags(fs, "warn")
+	format := addFormatFlag(fs)
+	fs.Parse(args)
+
+	ctx := context.Background()
+	service := services.NewProjectService(metadata.newGitDAO(false, metadata.newLogger()))
+	paths, err := service.Find(ctx, "", "")
+	if err != nil {
+		return err
+	}
+	projects := map[string]models.Project{}
+	for _, path := range paths {
+		project, _, err := service.Get(ctx, path)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		projects[path.String()] = project
+	}
+	return printData(stdout, *format, projects)
+}
+
+// update clones or updates the checkout and prints what git had to say.
+func update(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	metadata := addMetadataFlags(fs, "info")
+	fs.Parse(args)
+
+	service := services.NewGitService(metadata.newGitDAO(false, metadata.newLogger()))
+	output, err := service.UpdateClone(context.Background())
+	fmt.Fprint(stdout, output)
+	return err
+}
@@ -0,0 +1,91 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func withMetadata(t *testing.T) (string, func()) {
+	tmpdir, _ := ioutil.TempDir("", "")
+	for path, content := range map[string]string{
+		"projects/frameworks/solid/metadata.yaml": "repopath: solid\nname: Solid\n",
+		"projects/calligra/krita/metadata.yaml":   "repopath: krita\nname: Krita\n",
+	} {
+		path = filepath.Join(tmpdir, path)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte(content), 0644)
+	}
+	return tmpdir, func() { os.RemoveAll(tmpdir) }
+}
+
+func TestGet(t *testing.T) {
+	dir, cleanup := withMetadata(t)
+	defer cleanup()
+
+	var out bytes.Buffer
+	assert.NoError(t, get([]string{"-metadata", dir, "frameworks/solid"}, &out))
+	var project map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &project))
+	assert.Equal(t, "solid", project["repopath"])
+
+	out.Reset()
+	assert.NoError(t, get([]string{"-metadata", dir, "-format", "yaml", "calligra/krita"}, &out))
+	assert.NoError(t, yaml.Unmarshal(out.Bytes(), &project))
+	assert.Equal(t, "Krita", project["name"])
+
+	assert.Error(t, get([]string{"-metadata", dir}, &out))
+	assert.Error(t, get([]string{"-metadata", dir, "../etc"}, &out))
+	assert.Error(t, get([]string{"-metadata", dir, "-format", "xml", "calligra/krita"}, &out))
+}
+
+func TestFind(t *testing.T) {
+	dir, cleanup := withMetadata(t)
+	defer cleanup()
+
+	var out bytes.Buffer
+	assert.NoError(t, find([]string{"-metadata", dir, "--repopath", "krita"}, &out))
+	assert.JSONEq(t, `["calligra/krita"]`, out.String())
+
+	out.Reset()
+	assert.NoError(t, find([]string{"-metadata", dir}, &out))
+	assert.JSONEq(t, `["calligra/krita", "frameworks/solid"]`, out.String())
+}
+
+func TestDump(t *testing.T) {
+	dir, cleanup := withMetadata(t)
+	defer cleanup()
+
+	var out bytes.Buffer
+	assert.NoError(t, dump([]string{"-metadata", dir}, &out))
+	var projects map[string]map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &projects))
+	assert.Equal(t, "solid", projects["frameworks/solid"]["repopath"])
+	assert.Equal(t, "krita", projects["calligra/krita"]["repopath"])
+}
@@ -0,0 +1,242 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package client talks to the api.projects.kde.org API.
+//
+//	c := client.New("https://projects.kde.org/api/v1")
+//	project, err := c.GetProject(ctx, "frameworks/solid")
+//
+// Requests are retried with backoff when the server is rate limiting or
+// failing. Responses carrying an ETag are cached and revalidated.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors matching the status of an *Error, to be checked with errors.Is.
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServer       = errors.New("server error")
+)
+
+// Error is a response with an unsuccessful status.
+type Error struct {
+	StatusCode int
+	// Message is the error the server gave, if any.
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusBadRequest:
+		return ErrBadRequest
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusForbidden:
+		return ErrForbidden
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusConflict:
+		return ErrConflict
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= 500:
+		return ErrServer
+	}
+	return nil
+}
+
+// Cached responses are dropped once there are more.
+const maxCacheEntries = 256
+
+type cacheEntry struct {
+	etag string
+	body []byte
+}
+
+// Client is safe for concurrent use.
+type Client struct {
+	// BaseURL is the versioned root of the API, e.g.
+	// https://projects.kde.org/api/v1.
+	BaseURL    string
+	HTTPClient *http.Client
+	// Token is sent as bearer token. Only needed for Poll and SQL.
+	Token string
+	// MaxRetries is how often a rate limited or, for GETs, failed request is
+	// retried.
+	MaxRetries int
+	// Backoff is the wait before the first retry, doubled for every further
+	// one. A Retry-After of the server takes precedence.
+	Backoff time.Duration
+
+	cache      map[string]cacheEntry
+	cacheMutex sync.Mutex
+}
+
+// New returns a Client for the API at baseURL.
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+		MaxRetries: 3,
+		Backoff:    500 * time.Millisecond,
+		cache:      map[string]cacheEntry{},
+	}
+}
+
+// retryable tells whether a response is worth another attempt. Rate limited
+// requests were not handled at all, others may have been handled partly, so
+// only GETs are retried on server errors.
+func retryable(method string, code int) bool {
+	return code == http.StatusTooManyRequests || (method == http.MethodGet && code >= 500)
+}
+
+// wait sleeps before retry attempt, unless ctx is done first.
+func (c *Client) wait(ctx context.Context, attempt int, res *http.Response) error {
+	delay := c.Backoff << uint(attempt)
+	if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *Client) cached(key string) (cacheEntry, bool) {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+	entry, ok := c.cache[key]
+	return entry, ok
+}
+
+func (c *Client) store(key string, entry cacheEntry) {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+	if c.cache == nil || len(c.cache) >= maxCacheEntries {
+		c.cache = map[string]cacheEntry{}
+	}
+	c.cache[key] = entry
+}
+
+func errorFromBody(code int, body []byte) *Error {
+	e := &Error{StatusCode: code}
+	var object struct {
+		Error string `json:"error"`
+	}
+	var str string
+	if json.Unmarshal(body, &object) == nil && object.Error != "" {
+		e.Message = object.Error
+	} else if json.Unmarshal(body, &str) == nil {
+		e.Message = str
+	}
+	return e
+}
+
+// do sends a request to path below BaseURL and decodes the JSON response
+// into out. GET responses are revalidated against the cache.
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	url := c.BaseURL + path
+	entry, isCached := c.cached(url)
+	useCache := method == http.MethodGet && isCached
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.Token)
+		}
+		if useCache {
+			req.Header.Set("If-None-Match", entry.etag)
+		}
+
+		res, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(res.Body, 64<<20))
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case useCache && res.StatusCode == http.StatusNotModified:
+			data = entry.body
+		case res.StatusCode >= 200 && res.StatusCode < 300:
+			if etag := res.Header.Get("ETag"); etag != "" && method == http.MethodGet {
+				c.store(url, cacheEntry{etag, data})
+			}
+		case retryable(method, res.StatusCode) && attempt < c.MaxRetries:
+			if err = c.wait(ctx, attempt, res); err != nil {
+				return err
+			}
+			continue
+		default:
+			return errorFromBody(res.StatusCode, data)
+		}
+
+		if out == nil {
+			return nil
+		}
+		return json.Unmarshal(data, out)
+	}
+}
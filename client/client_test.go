@@ -0,0 +1,298 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/apis"
+	"anongit.kde.org/websites/api-projects-kde-org.git/daos"
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+	"anongit.kde.org/websites/api-projects-kde-org.git/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type pollDAO struct{}
+
+func (dao *pollDAO) UpdateClone(ctx context.Context) (string, error) {
+	return "Already up to date.", nil
+}
+
+func (dao *pollDAO) Revision() string {
+	return "rev"
+}
+
+func (dao *pollDAO) Diff(ctx context.Context, from string, to string, within int) (*models.Diff, error) {
+	return &models.Diff{}, nil
+}
+
+// withServer serves the API over a metadata fixture the same way the server
+// does, minus the clone updates.
+func withServer(t *testing.T) (*httptest.Server, func()) {
+	tmpdir, _ := ioutil.TempDir("", "")
+	for path, content := range map[string]string{
+		"projects/frameworks/solid/metadata.yaml": "repopath: solid\nname: Solid\n",
+		"projects/calligra/krita/metadata.yaml":   "repopath: krita\nname: Krita\n",
+	} {
+		path = filepath.Join(tmpdir, "repo-metadata", path)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte(content), 0644)
+	}
+	tokens := filepath.Join(tmpdir, "tokens.yaml")
+	ioutil.WriteFile(tokens, []byte("- name: ci\n  hash: "+models.HashToken("ci-secret")+"\n  scopes: [poll]\n"+
+		"- name: analyst\n  hash: "+models.HashToken("analyst-secret")+"\n  scopes: [read]\n"), 0644)
+
+	tokenDAO, err := daos.NewTokenDAO(tokens)
+	assert.NoError(t, err)
+	gitDAO := daos.NewGitDAO(filepath.Join(tmpdir, "repo-metadata"), false, slog.New(slog.NewTextHandler(ioutil.Discard, nil)))
+	gitService := services.NewGitService(gitDAO)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	v1 := router.Group("/v1", apis.Authenticate(services.NewAuthService(tokenDAO)), apis.CacheHeaders(gitService, daos.UpdateInterval))
+	apis.ServeGitResource(v1, services.NewPollService(&pollDAO{}))
+	projectService := services.NewProjectService(gitDAO)
+	apis.ServeProjectResource(v1, projectService, nil)
+	apis.ServeGraphQLResource(v1, projectService)
+	apis.ServeSQLResource(v1, services.NewSQLService(daos.NewDatabaseDAO(gitDAO)))
+	apis.ServeStatsResource(v1, services.NewStatsService(gitDAO))
+
+	server := httptest.NewServer(router)
+	return server, func() {
+		server.Close()
+		os.RemoveAll(tmpdir)
+	}
+}
+
+func TestGetProject(t *testing.T) {
+	server, cleanup := withServer(t)
+	defer cleanup()
+	c := New(server.URL + "/v1")
+
+	project, err := c.GetProject(context.Background(), "frameworks/solid")
+	assert.NoError(t, err)
+	assert.Equal(t, "Solid", project["name"])
+
+	_, err = c.GetProject(context.Background(), "frameworks/nope")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	var apiErr *Error
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+
+	projects, err := c.GetProjects(context.Background(), []string{"krita", "nope"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Krita", projects.Projects["krita"]["name"])
+	assert.Contains(t, projects.Errors, "nope")
+}
+
+func TestFind(t *testing.T) {
+	server, cleanup := withServer(t)
+	defer cleanup()
+	c := New(server.URL + "/v1")
+
+	paths, err := c.Find(context.Background(), "", "krita")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ProjectPath{"calligra/krita"}, paths)
+
+	paths, err = c.Find(context.Background(), "nope", "")
+	assert.NoError(t, err)
+	assert.Empty(t, paths)
+}
+
+func TestComplete(t *testing.T) {
+	server, cleanup := withServer(t)
+	defer cleanup()
+	c := New(server.URL + "/v1")
+
+	completions, err := c.Complete(context.Background(), "krit", 1)
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(completions)) {
+		assert.Equal(t, models.ProjectPath("calligra/krita"), completions[0].Path)
+	}
+
+	_, err = c.Complete(context.Background(), "", 0)
+	assert.True(t, errors.Is(err, ErrBadRequest))
+}
+
+func TestStats(t *testing.T) {
+	server, cleanup := withServer(t)
+	defer cleanup()
+	c := New(server.URL + "/v1")
+
+	report, err := c.Stats(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.NotZero(t, report.Current.Projects)
+	assert.Empty(t, report.Series)
+
+	_, err = c.Stats(context.Background(), -1)
+	assert.True(t, errors.Is(err, ErrBadRequest))
+}
+
+func TestPoll(t *testing.T) {
+	server, cleanup := withServer(t)
+	defer cleanup()
+	c := New(server.URL + "/v1")
+
+	_, err := c.Poll(context.Background())
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+
+	c.Token = "ci-secret"
+	job, err := c.Poll(context.Background())
+	assert.NoError(t, err)
+	for i := 0; i < 1000 && !job.Done(); i++ {
+		time.Sleep(time.Millisecond)
+		job, err = c.PollJob(context.Background(), job.ID)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, models.JobSucceeded, job.State)
+	assert.Equal(t, "Already up to date.", job.Output)
+
+	_, err = c.PollJob(context.Background(), "nope")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestGraphQL(t *testing.T) {
+	server, cleanup := withServer(t)
+	defer cleanup()
+	c := New(server.URL + "/v1")
+
+	var data struct {
+		Project struct {
+			Name string `json:"name"`
+		} `json:"project"`
+	}
+	err := c.GraphQL(context.Background(), `query($path: String!) { project(path: $path) { name } }`,
+		map[string]interface{}{"path": "frameworks/solid"}, &data)
+	assert.NoError(t, err)
+	assert.Equal(t, "Solid", data.Project.Name)
+
+	err = c.GraphQL(context.Background(), `{ nope }`, nil, nil)
+	var gqlErr *GraphQLError
+	assert.True(t, errors.As(err, &gqlErr))
+}
+
+func TestSQL(t *testing.T) {
+	server, cleanup := withServer(t)
+	defer cleanup()
+	c := New(server.URL + "/v1")
+	c.Token = "analyst-secret"
+
+	result, err := c.SQL(context.Background(), "SELECT name FROM projects ORDER BY path", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]interface{}{{"Krita"}}, result.Rows)
+	assert.True(t, result.Truncated)
+
+	_, err = c.SQL(context.Background(), "DROP TABLE projects", 0)
+	assert.True(t, errors.Is(err, ErrBadRequest))
+}
+
+func TestETag(t *testing.T) {
+	server, cleanup := withServer(t)
+	defer cleanup()
+	var statuses []int
+	wrapper := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := httptest.NewRecorder()
+		server.Config.Handler.ServeHTTP(recorder, r)
+		statuses = append(statuses, recorder.Code)
+		for key, values := range recorder.Header() {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(recorder.Code)
+		w.Write(recorder.Body.Bytes())
+	}))
+	defer wrapper.Close()
+	c := New(wrapper.URL + "/v1")
+
+	for i := 0; i < 2; i++ {
+		project, err := c.GetProject(context.Background(), "calligra/krita")
+		assert.NoError(t, err)
+		assert.Equal(t, "Krita", project["name"])
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusNotModified}, statuses)
+}
+
+func TestRetry(t *testing.T) {
+	server, cleanup := withServer(t)
+	defer cleanup()
+	var requests int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			server.Config.Handler.ServeHTTP(w, r)
+		}
+	}))
+	defer flaky.Close()
+	c := New(flaky.URL + "/v1")
+	c.Backoff = time.Millisecond
+
+	project, err := c.GetProject(context.Background(), "frameworks/solid")
+	assert.NoError(t, err)
+	assert.Equal(t, "Solid", project["name"])
+	assert.Equal(t, int32(3), requests)
+
+	// Other methods are only retried when rate limited, a failed one may
+	// have been handled partly.
+	atomic.StoreInt32(&requests, 0)
+	c.Token = "ci-secret"
+	_, err = c.Poll(context.Background())
+	assert.True(t, errors.Is(err, ErrServer))
+	assert.Equal(t, int32(1), requests)
+	_, err = c.Poll(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), requests)
+
+	// Giving up eventually.
+	atomic.StoreInt32(&requests, 0)
+	c.MaxRetries = 0
+	_, err = c.GetProject(context.Background(), "frameworks/solid")
+	assert.True(t, errors.Is(err, ErrServer))
+}
+
+func TestCancel(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	c := New(down.URL + "/v1")
+	c.Backoff = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := c.GetProject(ctx, "frameworks/solid")
+	assert.True(t, errors.Is(err, context.Canceled))
+}
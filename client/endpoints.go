@@ -0,0 +1,222 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+)
+
+// escapePath escapes the segments of a project path for use in a URL.
+func escapePath(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// GetProject gets the project at path.
+func (c *Client) GetProject(ctx context.Context, path string) (models.Project, error) {
+	var project models.Project
+	err := c.do(ctx, http.MethodGet, "/project/"+escapePath(path), nil, &project)
+	return project, err
+}
+
+// Projects is the result of GetProjects. Both maps are keyed by the
+// requested path or repopath.
+type Projects struct {
+	Projects map[string]models.Project `json:"projects"`
+	Errors   map[string]string         `json:"errors"`
+}
+
+// GetProjects gets many projects by path or repopath at once, all from the
+// same revision.
+func (c *Client) GetProjects(ctx context.Context, paths []string) (*Projects, error) {
+	projects := &Projects{}
+	err := c.do(ctx, http.MethodPost, "/projects", paths, projects)
+	return projects, err
+}
+
+// Find lists the paths of the projects matching id (basename) and repopath.
+// Empty constraints match everything. No match is no error.
+func (c *Client) Find(ctx context.Context, id string, repopath string) ([]models.ProjectPath, error) {
+	query := url.Values{}
+	if id != "" {
+		query.Set("id", id)
+	}
+	if repopath != "" {
+		query.Set("repopath", repopath)
+	}
+	paths := []models.ProjectPath{}
+	err := c.do(ctx, http.MethodGet, "/find?"+query.Encode(), nil, &paths)
+	if errors.Is(err, ErrNotFound) {
+		return []models.ProjectPath{}, nil
+	}
+	return paths, err
+}
+
+// Complete returns up to limit projects matching what a user typed so far,
+// best first. A limit of 0 is the server default.
+func (c *Client) Complete(ctx context.Context, q string, limit int) ([]models.Completion, error) {
+	query := url.Values{"q": {q}}
+	if limit != 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	completions := []models.Completion{}
+	err := c.do(ctx, http.MethodGet, "/complete?"+query.Encode(), nil, &completions)
+	return completions, err
+}
+
+// Poll queues an update of the server's clone. It needs a Token with the
+// poll scope. Follow the job with PollJob.
+func (c *Client) Poll(ctx context.Context) (models.PollJob, error) {
+	var job models.PollJob
+	err := c.do(ctx, http.MethodPost, "/poll", nil, &job)
+	return job, err
+}
+
+// PollJob gets a job queued by Poll.
+func (c *Client) PollJob(ctx context.Context, id string) (models.PollJob, error) {
+	var job models.PollJob
+	err := c.do(ctx, http.MethodGet, "/poll/"+url.PathEscape(id), nil, &job)
+	return job, err
+}
+
+func branchGroupQuery(branchGroup string) string {
+	if branchGroup == "" {
+		return ""
+	}
+	return "?" + url.Values{"branchgroup": {branchGroup}}.Encode()
+}
+
+// Dependencies lists the direct dependencies of path in a branch group. An
+// empty branch group is the server default.
+func (c *Client) Dependencies(ctx context.Context, branchGroup string, path string) ([]models.ProjectPath, error) {
+	var paths []models.ProjectPath
+	err := c.do(ctx, http.MethodGet, "/project/"+escapePath(path)+"/dependencies"+branchGroupQuery(branchGroup), nil, &paths)
+	return paths, err
+}
+
+// Dependents lists the projects directly depending on path in a branch
+// group. An empty branch group is the server default.
+func (c *Client) Dependents(ctx context.Context, branchGroup string, path string) ([]models.ProjectPath, error) {
+	var paths []models.ProjectPath
+	err := c.do(ctx, http.MethodGet, "/project/"+escapePath(path)+"/dependents"+branchGroupQuery(branchGroup), nil, &paths)
+	return paths, err
+}
+
+// BuildOrder orders paths and everything they depend on so dependencies
+// come first. A cycle is an error matching ErrConflict.
+func (c *Client) BuildOrder(ctx context.Context, branchGroup string, paths []string) ([]models.ProjectPath, error) {
+	query := url.Values{"project": paths}
+	if branchGroup != "" {
+		query.Set("branchgroup", branchGroup)
+	}
+	var order []models.ProjectPath
+	err := c.do(ctx, http.MethodGet, "/buildorder?"+query.Encode(), nil, &order)
+	return order, err
+}
+
+// Branches gets the branch of every project in a branch group.
+func (c *Client) Branches(ctx context.Context, group string) (map[models.ProjectPath]string, error) {
+	var branches map[models.ProjectPath]string
+	err := c.do(ctx, http.MethodGet, "/branchgroup/"+url.PathEscape(group), nil, &branches)
+	return branches, err
+}
+
+// Branch gets the branch of path in a branch group.
+func (c *Client) Branch(ctx context.Context, group string, path string) (string, error) {
+	var branch string
+	err := c.do(ctx, http.MethodGet, "/branchgroup/"+url.PathEscape(group)+"/"+escapePath(path), nil, &branch)
+	return branch, err
+}
+
+// Diff compares the projects of two revisions. An empty to is the revision
+// being served.
+func (c *Client) Diff(ctx context.Context, from string, to string) (*models.Diff, error) {
+	query := url.Values{"from": {from}}
+	if to != "" {
+		query.Set("to", to)
+	}
+	diff := &models.Diff{}
+	err := c.do(ctx, http.MethodGet, "/diff?"+query.Encode(), nil, diff)
+	return diff, err
+}
+
+// SQL runs a read-only statement against a SQLite database of the projects
+// and returns at most limit rows, 0 being the server default. It needs a
+// Token with the read scope.
+func (c *Client) SQL(ctx context.Context, query string, limit int) (*models.QueryResult, error) {
+	result := &models.QueryResult{}
+	body := map[string]interface{}{"query": query, "limit": limit}
+	err := c.do(ctx, http.MethodPost, "/sql", body, result)
+	return result, err
+}
+
+// Stats returns aggregates over the served projects and over up to
+// revisions recent revisions, 0 leaving the series empty.
+func (c *Client) Stats(ctx context.Context, revisions int) (*models.StatsReport, error) {
+	report := &models.StatsReport{}
+	err := c.do(ctx, http.MethodGet, "/stats?revisions="+strconv.Itoa(revisions), nil, report)
+	return report, err
+}
+
+// GraphQLError lists the errors of a GraphQL query.
+type GraphQLError struct {
+	Messages []string
+}
+
+func (e *GraphQLError) Error() string {
+	return "graphql: " + strings.Join(e.Messages, "; ")
+}
+
+// GraphQL runs query and decodes its data into out.
+func (c *Client) GraphQL(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	body := map[string]interface{}{"query": query, "variables": variables}
+	if err := c.do(ctx, http.MethodPost, "/graphql", body, &result); err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		e := &GraphQLError{}
+		for _, err := range result.Errors {
+			e.Messages = append(e.Messages, err.Message)
+		}
+		return e
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(result.Data, out)
+}
@@ -0,0 +1,136 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log/slog"
+	"os"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/daos"
+	"anongit.kde.org/websites/api-projects-kde-org.git/logging"
+)
+
+// metadataFlags configure where metadata comes from. They are shared by
+// all commands.
+type metadataFlags struct {
+	dir              *string
+	urlTemplatesFile *string
+	sourcesFile      *string
+	overridesFile    *string
+	redirectsFile    *string
+	storeFile        *string
+	buildMetadata    *bool
+	buildMetadataDir *string
+	logFormat        *string
+	logLevel         *string
+}
+
+func addMetadataFlags(fs *flag.FlagSet, defaultLogLevel string) *metadataFlags {
+	return &metadataFlags{
+		dir: fs.String("metadata", "repo-metadata", "repo-metadata checkout"),
+		urlTemplatesFile: fs.String("url-templates", "",
+			"JSON file mapping urls keys (clone, push, browse, bugs, apidocs) to templates"),
+		sourcesFile: fs.String("sources", "",
+			"JSON file listing metadata sources laid over repo-metadata, lowest first"),
+		overridesFile: fs.String("overrides", "",
+			"YAML file of per project field overrides, reloaded on change"),
+		redirectsFile: fs.String("redirects", "",
+			"YAML file mapping old project paths to new ones, in addition to moves found in history"),
+		storeFile: fs.String("store", "",
+			"file persisting resolved projects, they are served from it until the checkout is usable"),
+		buildMetadata: fs.Bool("build-metadata", false,
+			"track kde-build-metadata and serve dependency data"),
+		buildMetadataDir: fs.String("build-metadata-dir", daos.DefaultBuildMetadataDir,
+			"kde-build-metadata checkout, used with -build-metadata"),
+		logFormat: fs.String("log-format", "logfmt", "log format, json or logfmt"),
+		logLevel: fs.String("log-level", defaultLogLevel,
+			"least level logged, one of debug, info, warn or error"),
+	}
+}
+
+func (f *metadataFlags) newLogger() *slog.Logger {
+	logger, err := logging.New(os.Stderr, *f.logFormat, *f.logLevel)
+	if err != nil {
+		fatal(err)
+	}
+	slog.SetDefault(logger)
+	return logger
+}
+
+// newGitDAO configures the DAO before it gets to update, so even the first
+// update takes all sources into account.
+func (f *metadataFlags) newGitDAO(autoUpdate bool, logger *slog.Logger) *daos.GitDAO {
+	gitDAO := daos.NewGitDAO(*f.dir, false, logger)
+	if *f.urlTemplatesFile != "" {
+		data, err := ioutil.ReadFile(*f.urlTemplatesFile)
+		if err != nil {
+			fatal(err)
+		}
+		var templates daos.URLTemplates
+		if err = json.Unmarshal(data, &templates); err != nil {
+			fatal(err)
+		}
+		gitDAO.SetURLTemplates(templates)
+	}
+	if *f.sourcesFile != "" {
+		data, err := ioutil.ReadFile(*f.sourcesFile)
+		if err != nil {
+			fatal(err)
+		}
+		var sources []daos.Source
+		if err = json.Unmarshal(data, &sources); err != nil {
+			fatal(err)
+		}
+		for _, source := range sources {
+			gitDAO.AddSource(source)
+		}
+	}
+	if *f.overridesFile != "" {
+		if err := gitDAO.SetOverridesFile(*f.overridesFile); err != nil {
+			fatal(err)
+		}
+	}
+	if *f.redirectsFile != "" {
+		if err := gitDAO.SetRedirectsFile(*f.redirectsFile); err != nil {
+			fatal(err)
+		}
+	}
+	if *f.buildMetadata {
+		gitDAO.EnableBuildMetadata(*f.buildMetadataDir)
+	}
+	if *f.storeFile != "" {
+		store, err := daos.OpenStore(*f.storeFile)
+		if err != nil {
+			fatal(err)
+		}
+		if err = gitDAO.SetStore(context.Background(), store); err != nil {
+			fatal(err)
+		}
+	}
+	if autoUpdate {
+		gitDAO.AutoUpdate()
+	}
+	return gitDAO
+}
@@ -0,0 +1,151 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+)
+
+// loadLogicalModuleStructure parses the branch groups of
+// logical-module-structure. The file maps project patterns to the branch of
+// every group, like kdesrc-build reads it:
+//
+//	"groups": {
+//	  "kde/*": { "kf5-qt5": "master", "stable-kf5-qt5": "Applications/17.08" }
+//	}
+//
+// This turns it around into group names to cascades of project patterns to
+// branches, so the most specific pattern with a branch in the group wins.
+// Cached until kde-build-metadata or repo-metadata change.
+func (dao *GitDAO) loadLogicalModuleStructure() (map[string]*globCascade, error) {
+	if dao.buildMetadataDir == "" {
+		return nil, models.ErrUnknownBranchGroup
+	}
+	dao.cacheMutex.Lock()
+	structure := dao.logicalModuleStructure
+	dao.cacheMutex.Unlock()
+	if structure != nil {
+		return structure, nil
+	}
+
+	file, err := os.Open(filepath.Join(dao.buildMetadataDir, "logical-module-structure"))
+	if os.IsNotExist(err) {
+		return nil, models.ErrBranchGroupsUnavailable
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var data struct {
+		Groups json.RawMessage `json:"groups"`
+	}
+	if err = json.NewDecoder(file).Decode(&data); err != nil {
+		return nil, err
+	}
+	var patterns []globRule
+	if data.Groups != nil {
+		if patterns, err = decodeGlobRules(bytes.NewReader(data.Groups)); err != nil {
+			return nil, err
+		}
+	}
+	structure = map[string]*globCascade{}
+	for _, pattern := range patterns {
+		branches, ok := pattern.value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("logical-module-structure: branches of %s are no object", pattern.pattern)
+		}
+		for group, branch := range branches {
+			cascade, ok := structure[group]
+			if !ok {
+				cascade = &globCascade{mostSpecific: true}
+				structure[group] = cascade
+			}
+			cascade.rules = append(cascade.rules, globRule{pattern.pattern, branch})
+		}
+	}
+
+	dao.cacheMutex.Lock()
+	dao.logicalModuleStructure = structure
+	dao.cacheMutex.Unlock()
+	return structure, nil
+}
+
+func (dao *GitDAO) branchGroup(group string) (*globCascade, error) {
+	structure, err := dao.loadLogicalModuleStructure()
+	if err != nil {
+		return nil, err
+	}
+	cascade, ok := structure[group]
+	if !ok {
+		return nil, models.ErrUnknownBranchGroup
+	}
+	return cascade, nil
+}
+
+// Branch resolves the git branch of path in a branch group.
+func (dao *GitDAO) Branch(ctx context.Context, group string, path models.ProjectPath) (string, error) {
+	dao.repoMutex.RLock()
+	defer dao.repoMutex.RUnlock()
+
+	cascade, err := dao.branchGroup(group)
+	if err != nil {
+		return "", err
+	}
+	if !dao.isProject(path) {
+		return "", models.ErrNotFound
+	}
+	branch, ok := cascade.match(path)
+	if str, isString := branch.(string); ok && isString && str != "" {
+		return str, nil
+	}
+	return "", models.ErrNoBranch
+}
+
+// Branches resolves the git branch of every project in a branch group.
+// Projects without a branch in the group are left out.
+func (dao *GitDAO) Branches(ctx context.Context, group string) (map[models.ProjectPath]string, error) {
+	dao.repoMutex.RLock()
+	defer dao.repoMutex.RUnlock()
+
+	cascade, err := dao.branchGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := dao.find(ctx, "", "")
+	if err != nil {
+		return nil, err
+	}
+	branches := map[models.ProjectPath]string{}
+	for _, path := range paths {
+		branch, ok := cascade.match(path)
+		if str, isString := branch.(string); ok && isString && str != "" {
+			branches[path] = str
+		}
+	}
+	return branches, nil
+}
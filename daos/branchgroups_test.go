@@ -0,0 +1,96 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBranchGroups(t *testing.T) {
+	defer withDependencyFixture("")()
+	// Excerpt in the layout of kde-build-metadata's logical-module-structure.
+	ioutil.WriteFile("build/kde-build-metadata/logical-module-structure", []byte(`{
+		"version": "1",
+		"layers": [
+			"qt5",
+			"kf5",
+			"calligra"
+		],
+		"groups": {
+			"kde/kdelibs": {
+				"latest-qt4": "KDE/4.14",
+				"stable-qt4": "KDE/4.14",
+				"kf5-qt5": "frameworks"
+			},
+			"frameworks/*": {
+				"kf5-qt5": "master",
+				"stable-kf5-qt5": "master"
+			},
+			"calligra/*": {
+				"kf5-qt5": "master",
+				"stable-kf5-qt5": "calligra/3.1",
+				"stable-qt4": "calligra/2.9"
+			},
+			"calligra/krita": {
+				"kf5-qt5": "master",
+				"stable-kf5-qt5": "krita/4.0"
+			}
+		}
+	}`), 0644)
+
+	dao := NewGitDAOInternal(false)
+	dao.EnableBuildMetadata("build/kde-build-metadata")
+
+	branch, err := dao.Branch(context.Background(), "stable-kf5-qt5", "calligra/krita")
+	assert.NoError(t, err)
+	assert.Equal(t, "krita/4.0", branch)
+	// krita has no stable-qt4 branch of its own, so calligra/* applies
+	branch, err = dao.Branch(context.Background(), "stable-qt4", "calligra/krita")
+	assert.NoError(t, err)
+	assert.Equal(t, "calligra/2.9", branch)
+
+	_, err = dao.Branch(context.Background(), "latest-qt4", "calligra/krita")
+	assert.Equal(t, models.ErrNoBranch, err)
+	_, err = dao.Branch(context.Background(), "kf6-qt6", "calligra/krita")
+	assert.Equal(t, models.ErrUnknownBranchGroup, err)
+	_, err = dao.Branch(context.Background(), "kf5-qt5", "frameworks/nope")
+	assert.Equal(t, models.ErrNotFound, err)
+
+	branches, err := dao.Branches(context.Background(), "stable-kf5-qt5")
+	assert.NoError(t, err)
+	assert.Equal(t, map[models.ProjectPath]string{
+		"calligra/krita":                 "krita/4.0",
+		"frameworks/extra-cmake-modules": "master",
+		"frameworks/kio":                 "master",
+		"frameworks/solid":               "master",
+	}, branches)
+
+	os.Remove("build/kde-build-metadata/logical-module-structure")
+	dao.resetCache(context.Background())
+	_, err = dao.Branches(context.Background(), "stable-kf5-qt5")
+	assert.Equal(t, models.ErrBranchGroupsUnavailable, err)
+}
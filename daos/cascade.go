@@ -0,0 +1,129 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+	"github.com/danwakefield/fnmatch"
+)
+
+// globRule maps an fnmatch pattern relative to the projects directory,
+// e.g. "frameworks/*", to a value.
+type globRule struct {
+	pattern string
+	value   interface{}
+}
+
+// globCascade resolves values for project paths from an ordered list of
+// glob rules. Both i18n_defaults.json and logical-module-structure are
+// expressed this way, they only differ in which matching rule wins.
+type globCascade struct {
+	rules []globRule
+	// When set the most specific matching rule wins, otherwise the first one.
+	mostSpecific bool
+}
+
+// decodeGlobRules reads a JSON object of pattern to value. Unlike decoding
+// into a map this retains the order of the object, which repo-metadata
+// documents as significant.
+func decodeGlobRules(r io.Reader) ([]globRule, error) {
+	decoder := json.NewDecoder(r)
+	rules, err := decodeOrderedObject(decoder)
+	if err != nil {
+		return nil, err
+	}
+	// Nothing may follow the object.
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("trailing data after glob rules")
+	}
+	return rules, nil
+}
+
+// decodeOrderedObject decodes the next object of decoder as rules.
+func decodeOrderedObject(decoder *json.Decoder) ([]globRule, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, errors.New("glob rules must be an object")
+	}
+	rules := []globRule{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if err = decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		rules = append(rules, globRule{token.(string), value})
+	}
+	_, err = decoder.Token() // closing }
+	return rules, err
+}
+
+// specificity orders patterns like kdesrc-build does: literal patterns beat
+// wildcards, then deeper patterns beat shallower ones, then longer ones win.
+func specificity(pattern string) (bool, int, int) {
+	return !strings.ContainsAny(pattern, "*?["), strings.Count(pattern, "/"), len(pattern)
+}
+
+func moreSpecific(a string, b string) bool {
+	aLiteral, aDepth, aLength := specificity(a)
+	bLiteral, bDepth, bLength := specificity(b)
+	if aLiteral != bLiteral {
+		return aLiteral
+	}
+	if aDepth != bDepth {
+		return aDepth > bDepth
+	}
+	return aLength > bLength
+}
+
+// match returns the value of the winning rule for path.
+func (g *globCascade) match(path models.ProjectPath) (interface{}, bool) {
+	// Patterns are relative but rooted, "*" must not match in the middle.
+	absPath := "/" + path.String()
+	var winner *globRule
+	for i := range g.rules {
+		rule := &g.rules[i]
+		if !fnmatch.Match("/"+strings.TrimPrefix(rule.pattern, "/"), absPath, 0) {
+			continue
+		}
+		if !g.mostSpecific {
+			return rule.value, true
+		}
+		if winner == nil || moreSpecific(rule.pattern, winner.pattern) {
+			winner = rule
+		}
+	}
+	if winner == nil {
+		return nil, false
+	}
+	return winner.value, true
+}
@@ -0,0 +1,63 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlobCascadeFirstMatch(t *testing.T) {
+	rules, err := decodeGlobRules(strings.NewReader(`{"frameworks/solid": 1, "frameworks/*": 2, "*": 3}`))
+	assert.NoError(t, err)
+	cascade := &globCascade{rules: rules}
+
+	// Order is retained, first match wins.
+	for i := 0; i < 10; i++ {
+		value, ok := cascade.match("frameworks/solid")
+		assert.True(t, ok)
+		assert.Equal(t, 1.0, value)
+	}
+	value, _ := cascade.match("frameworks/kio")
+	assert.Equal(t, 2.0, value)
+	value, _ = cascade.match("calligra")
+	assert.Equal(t, 3.0, value)
+}
+
+func TestGlobCascadeMostSpecific(t *testing.T) {
+	rules, err := decodeGlobRules(strings.NewReader(`{"*": "a", "kde/*": "b", "kde/kdegraphics/*": "c", "kde/kdegraphics/okular": "d"}`))
+	assert.NoError(t, err)
+	cascade := &globCascade{rules: rules, mostSpecific: true}
+
+	value, _ := cascade.match("kde/kdegraphics/okular")
+	assert.Equal(t, "d", value)
+	value, _ = cascade.match("kde/kdegraphics/gwenview")
+	assert.Equal(t, "c", value)
+	value, _ = cascade.match("kde/workspace")
+	assert.Equal(t, "b", value)
+	value, _ = cascade.match("calligra")
+	assert.Equal(t, "a", value)
+
+	_, err = decodeGlobRules(strings.NewReader(`["x"]`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,281 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+)
+
+// How many paths are suggested for a missing project.
+const maxSuggestions = 5
+
+// Longer paths get no suggestions, comparing them is too costly.
+const maxSuggestInput = 256
+
+// completionIndex holds what typeahead and suggestions match against, so a
+// keystroke does not resolve every project.
+type completionIndex struct {
+	entries []completionEntry
+}
+
+type completionEntry struct {
+	path     models.ProjectPath
+	name     string
+	repopath string
+	// Lower case values matched against, by field.
+	fields map[string]string
+}
+
+// Ranks of the ways a field may match, best first.
+var completionMatches = []string{"prefix", "substring", "fuzzy"}
+
+func (dao *GitDAO) loadCompletionIndex(ctx context.Context) (*completionIndex, error) {
+	index := &completionIndex{}
+	err := dao.walk(func(path models.ProjectPath) error {
+		project, err := dao.get(ctx, path)
+		if err != nil {
+			return err
+		}
+		entry := completionEntry{path: path, fields: map[string]string{
+			"path": strings.ToLower(string(path)),
+		}}
+		if name, ok := project["name"].(string); ok {
+			entry.name = name
+			entry.fields["name"] = strings.ToLower(name)
+		}
+		if repopath, ok := project["repopath"].(string); ok {
+			entry.repopath = repopath
+			entry.fields["repopath"] = strings.ToLower(repopath)
+		}
+		index.entries = append(index.entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func (dao *GitDAO) getCompletionIndex(ctx context.Context) (*completionIndex, error) {
+	dao.cacheMutex.Lock()
+	index := dao.completion
+	dao.cacheMutex.Unlock()
+	if index != nil {
+		return index, nil
+	}
+	index, err := dao.loadCompletionIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dao.cacheMutex.Lock()
+	dao.completion = index
+	dao.cacheMutex.Unlock()
+	return index, nil
+}
+
+// matchField returns how query matches value as an index into
+// completionMatches and, for fuzzy matches, how many characters were
+// skipped. The path also matches by prefix of any of its segments.
+func matchField(field string, value string, query string) (int, int, bool) {
+	if strings.HasPrefix(value, query) ||
+		(field == "path" && strings.Contains(value, "/"+query)) {
+		return 0, 0, true
+	}
+	if strings.Contains(value, query) {
+		return 1, 0, true
+	}
+	// Fuzzy: query is a subsequence of value.
+	runes := []rune(query)
+	skipped, i := 0, 0
+	for _, r := range value {
+		if i < len(runes) && r == runes[i] {
+			i++
+		} else if i > 0 && i < len(runes) {
+			skipped++
+		}
+	}
+	if i < len(runes) {
+		return 0, 0, false
+	}
+	return 2, skipped, true
+}
+
+// Complete returns up to limit projects whose path, name or repopath match
+// query, best matches first: prefixes before substrings before fuzzy
+// matches, the latter ranked by how scattered they are.
+func (dao *GitDAO) Complete(ctx context.Context, query string, limit int) ([]models.Completion, error) {
+	dao.rlock(ctx)
+	defer dao.repoMutex.RUnlock()
+	index, err := dao.getCompletionIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.ToLower(query)
+	type ranked struct {
+		completion models.Completion
+		rank       int
+		skipped    int
+	}
+	var matches []ranked
+	for _, entry := range index.entries {
+		best := ranked{rank: len(completionMatches)}
+		// Fixed order so ties prefer the same field every time.
+		for _, field := range []string{"name", "repopath", "path"} {
+			value, ok := entry.fields[field]
+			if !ok {
+				continue
+			}
+			rank, skipped, ok := matchField(field, value, query)
+			if ok && (rank < best.rank || (rank == best.rank && skipped < best.skipped)) {
+				best = ranked{models.Completion{
+					Path:     entry.path,
+					Name:     entry.name,
+					Repopath: entry.repopath,
+					Field:    field,
+					Match:    completionMatches[rank],
+				}, rank, skipped}
+			}
+		}
+		if best.rank < len(completionMatches) {
+			matches = append(matches, best)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.rank != b.rank {
+			return a.rank < b.rank
+		}
+		if a.skipped != b.skipped {
+			return a.skipped < b.skipped
+		}
+		if len(a.completion.Path) != len(b.completion.Path) {
+			return len(a.completion.Path) < len(b.completion.Path)
+		}
+		return a.completion.Path < b.completion.Path
+	})
+
+	completions := []models.Completion{}
+	for i := 0; i < len(matches) && i < limit; i++ {
+		completions = append(completions, matches[i].completion)
+	}
+	return completions, nil
+}
+
+// editDistance is the Levenshtein distance of a and b. It gives up once the
+// distance is known to exceed limit and returns limit + 1 then.
+func editDistance(a string, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra)-len(rb) > limit || len(rb)-len(ra) > limit {
+		return limit + 1
+	}
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		best := i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			best = min(best, current[j])
+		}
+		if best > limit {
+			return limit + 1
+		}
+		previous, current = current, previous
+	}
+	return min(previous[len(rb)], limit+1)
+}
+
+// Suggest returns the project paths closest to path, which names no project.
+// Projects with the same name come first, then those within a few edits.
+func (dao *GitDAO) Suggest(ctx context.Context, path models.ProjectPath) []models.ProjectPath {
+	if len(path) > maxSuggestInput {
+		return []models.ProjectPath{}
+	}
+	dao.rlock(ctx)
+	defer dao.repoMutex.RUnlock()
+	index, err := dao.getCompletionIndex(ctx)
+	if err != nil {
+		dao.log(ctx).Error("failed to load completion index", "error", err)
+		return []models.ProjectPath{}
+	}
+
+	wanted := strings.ToLower(string(path))
+	name := strings.ToLower(path.Name())
+	// Allow about one typo in three characters.
+	maxDistance := max(2, len(wanted)/3)
+	type ranked struct {
+		path     models.ProjectPath
+		sameName bool
+		distance int
+	}
+	var candidates []ranked
+	// Distances of the closest candidates so far. Once there are enough,
+	// paths further away than all of them cannot make it.
+	closest := []int{}
+	for _, entry := range index.entries {
+		candidate := ranked{path: entry.path, sameName: strings.ToLower(entry.path.Name()) == name}
+		limit := maxDistance
+		if candidate.sameName {
+			limit = len(wanted) + len(entry.fields["path"]) // Only ordered by distance.
+		} else if len(closest) == maxSuggestions {
+			limit = closest[maxSuggestions-1]
+		}
+		// Paths differing in length by more than limit are skipped right away.
+		candidate.distance = editDistance(wanted, entry.fields["path"], limit)
+		if candidate.distance > limit {
+			continue
+		}
+		candidates = append(candidates, candidate)
+		if !candidate.sameName {
+			closest = append(closest, candidate.distance)
+			sort.Ints(closest)
+			closest = closest[:min(len(closest), maxSuggestions)]
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.sameName != b.sameName {
+			return a.sameName
+		}
+		if a.distance != b.distance {
+			return a.distance < b.distance
+		}
+		return a.path < b.path
+	})
+
+	suggestions := []models.ProjectPath{}
+	for i := 0; i < len(candidates) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, candidates[i].path)
+	}
+	return suggestions
+}
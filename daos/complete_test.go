@@ -0,0 +1,99 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComplete(t *testing.T) {
+	defer withFixture(map[string]string{
+		"projects/calligra/krita/metadata.yaml":           "repopath: krita\nname: Krita\n",
+		"projects/frameworks/kirigami/metadata.yaml":      "repopath: kirigami\nname: Kirigami\n",
+		"projects/frameworks/solid/metadata.yaml":         "repopath: solid\nname: Solid\n",
+		"projects/extragear/base/krusader/metadata.yaml":  "repopath: krusader\nname: Krusader\n",
+		"projects/extragear/office/skrooge/metadata.yaml": "repopath: skrooge\nname: Skrooge\n",
+	})()
+	ctx := context.Background()
+	dao := NewGitDAOInternal(false)
+
+	completions, err := dao.Complete(ctx, "KRI", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Completion{
+		{Path: "calligra/krita", Name: "Krita", Repopath: "krita", Field: "name", Match: "prefix"},
+		{Path: "frameworks/kirigami", Name: "Kirigami", Repopath: "kirigami", Field: "name", Match: "fuzzy"},
+	}, completions)
+
+	completions, err = dao.Complete(ctx, "frameworks/s", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Completion{
+		{Path: "frameworks/solid", Name: "Solid", Repopath: "solid", Field: "path", Match: "prefix"},
+	}, completions)
+
+	completions, err = dao.Complete(ctx, "oo", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(completions))
+	assert.Equal(t, models.ProjectPath("extragear/office/skrooge"), completions[0].Path)
+	assert.Equal(t, "substring", completions[0].Match)
+	assert.Equal(t, "fuzzy", completions[1].Match, "frameworks/solid")
+
+	completions, err = dao.Complete(ctx, "kr", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(completions))
+	assert.Equal(t, models.ProjectPath("calligra/krita"), completions[0].Path, "shorter paths first")
+
+	completions, err = dao.Complete(ctx, "xyz", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Completion{}, completions)
+}
+
+func TestSuggest(t *testing.T) {
+	defer withFixture(map[string]string{
+		"projects/calligra/krita/metadata.yaml":      "repopath: krita\n",
+		"projects/frameworks/kirigami/metadata.yaml": "repopath: kirigami\n",
+		"projects/frameworks/solid/metadata.yaml":    "repopath: solid\n",
+		"projects/kde/workspace/solid/metadata.yaml": "repopath: solid-workspace\n",
+	})()
+	ctx := context.Background()
+	dao := NewGitDAOInternal(false)
+
+	assert.Equal(t, []models.ProjectPath{"calligra/krita"}, dao.Suggest(ctx, "calligra/kirta"))
+	assert.Equal(t, []models.ProjectPath{"frameworks/solid", "kde/workspace/solid"},
+		dao.Suggest(ctx, "kdelibs/solid"), "same name first")
+	assert.Equal(t, []models.ProjectPath{}, dao.Suggest(ctx, "nothing/like/it"))
+	long := models.ProjectPath(strings.Repeat("calligra/", 40) + "krita")
+	assert.Equal(t, []models.ProjectPath{}, dao.Suggest(ctx, long), "too long to compare")
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("krita", "krita", 10))
+	assert.Equal(t, 2, editDistance("kirta", "krita", 10))
+	assert.Equal(t, 3, editDistance("kitten", "sitting", 10))
+	assert.Equal(t, 5, editDistance("", "solid", 10))
+	assert.Equal(t, 3, editDistance("kitten", "sitting", 3))
+	assert.Equal(t, 3, editDistance("kitten", "sitting", 2), "gives up past the limit")
+	assert.Equal(t, 2, editDistance("", "solid", 1), "lengths alone too far apart")
+}
@@ -0,0 +1,343 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// DatabaseSchema is the schema of the SQLite database of a revision.
+const DatabaseSchema = `CREATE TABLE meta (
+  key TEXT PRIMARY KEY, -- revision
+  value TEXT NOT NULL
+);
+CREATE TABLE projects (
+  path TEXT PRIMARY KEY, -- e.g. frameworks/solid
+  toplevel TEXT NOT NULL, -- first segment of path, e.g. frameworks
+  name TEXT,
+  description TEXT,
+  icon TEXT,
+  type TEXT,
+  repopath TEXT,
+  hasrepo INTEGER NOT NULL, -- 0 or 1
+  repoactive INTEGER NOT NULL, -- 0 or 1
+  json TEXT NOT NULL -- the project as served by /project
+);
+CREATE TABLE i18n (
+  path TEXT NOT NULL REFERENCES projects(path),
+  key TEXT NOT NULL, -- e.g. trunk_kf5
+  value TEXT, -- branch, none for no branch
+  PRIMARY KEY (path, key)
+);
+CREATE TABLE members (
+  path TEXT NOT NULL REFERENCES projects(path),
+  username TEXT,
+  displayname TEXT,
+  email TEXT,
+  json TEXT NOT NULL -- the member as listed in metadata.yaml
+);
+`
+
+type projectLister interface {
+	Revision() string
+	GetAll(ctx context.Context) (map[models.ProjectPath]models.Project, string, error)
+}
+
+// DatabaseDAO answers read-only SQL queries against an in-memory SQLite
+// database of the projects. The database is rebuilt whenever the revision
+// changes.
+type DatabaseDAO struct {
+	projects projectLister
+	// Held while the database is used, one query at a time.
+	busy chan struct{}
+	// The connection the database was built with. The database in memory
+	// lives as long as it.
+	db   *sql.DB
+	conn *sql.Conn
+	// Opens the database read-only for queries.
+	readOnly *sql.DB
+	revision string
+}
+
+// databases numbers the databases in memory, their names are process wide.
+var databases atomic.Int64
+
+func NewDatabaseDAO(projects projectLister) *DatabaseDAO {
+	return &DatabaseDAO{projects: projects, busy: make(chan struct{}, 1)}
+}
+
+// acquire waits for the connection unless ctx is done first.
+func (dao *DatabaseDAO) acquire(ctx context.Context) error {
+	select {
+	case dao.busy <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (dao *DatabaseDAO) release() {
+	<-dao.busy
+}
+
+func nullable(project models.Project, key string) interface{} {
+	if str, ok := project[key].(string); ok {
+		return str
+	}
+	return nil
+}
+
+func toplevel(path models.ProjectPath) string {
+	return strings.SplitN(path.String(), "/", 2)[0]
+}
+
+func load(ctx context.Context, conn *sql.Conn, projects map[models.ProjectPath]models.Project, revision string) error {
+	if _, err := conn.ExecContext(ctx, DatabaseSchema); err != nil {
+		return err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`INSERT INTO meta VALUES ('revision', ?)`, revision); err != nil {
+		return err
+	}
+	for path, project := range projects {
+		data, err := json.Marshal(project)
+		if err != nil {
+			return err
+		}
+		hasrepo, _ := project["hasrepo"].(bool)
+		repoactive, _ := project["repoactive"].(bool)
+		_, err = tx.Exec(`INSERT INTO projects VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			path.String(), toplevel(path), nullable(project, "name"), nullable(project, "description"),
+			nullable(project, "icon"), nullable(project, "type"), nullable(project, "repopath"),
+			hasrepo, repoactive, string(data))
+		if err != nil {
+			return err
+		}
+		i18n, _ := project["i18n"].(map[string]interface{})
+		for key, value := range i18n {
+			if _, err = tx.Exec(`INSERT INTO i18n VALUES (?, ?, ?)`, path.String(), key, value); err != nil {
+				return err
+			}
+		}
+		members, _ := project["members"].([]interface{})
+		for _, member := range members {
+			fields, ok := member.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			data, err := json.Marshal(fields)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(`INSERT INTO members VALUES (?, ?, ?, ?, ?)`, path.String(),
+				nullable(fields, "username"), nullable(fields, "displayname"), nullable(fields, "email"), string(data))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// build creates the database of the current revision.
+func (dao *DatabaseDAO) build(ctx context.Context) error {
+	projects, revision, err := dao.projects.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("file:/metadata-%d?vfs=memdb", databases.Add(1))
+	db, err := sql.Open("sqlite", name)
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn(ctx)
+	if err == nil {
+		err = load(ctx, conn, projects, revision)
+	}
+	if err != nil {
+		db.Close()
+		return err
+	}
+	readOnly, err := sql.Open("sqlite", name+"&mode=ro")
+	if err != nil {
+		conn.Close()
+		db.Close()
+		return err
+	}
+	// Connections are closed after their query rather than reused.
+	readOnly.SetMaxIdleConns(0)
+
+	if dao.db != nil {
+		dao.readOnly.Close()
+		dao.conn.Close()
+		dao.db.Close()
+	}
+	dao.db, dao.conn, dao.readOnly, dao.revision = db, conn, readOnly, revision
+	return nil
+}
+
+// MaxQueryBytes is how many bytes the values of a query result may take, as
+// well as any single value built while running the query.
+const MaxQueryBytes = 8 << 20
+
+// session opens a connection for a single query. SQLite refuses any write
+// to the database through it, whatever pragmas the query sets, and temporary
+// tables it creates are gone with it.
+func (dao *DatabaseDAO) session(ctx context.Context) (*sql.Conn, error) {
+	conn, err := dao.readOnly.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Attaching would give access to files on disk.
+	_, err = sqlite.Limit(conn, sqlite3.SQLITE_LIMIT_ATTACHED, 0)
+	if err == nil {
+		_, err = sqlite.Limit(conn, sqlite3.SQLITE_LIMIT_LENGTH, MaxQueryBytes)
+	}
+	if err == nil {
+		_, err = conn.ExecContext(ctx, `PRAGMA query_only = ON`)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// current acquires the connection and makes sure the database is of the
+// current revision. The caller releases.
+func (dao *DatabaseDAO) current(ctx context.Context) error {
+	if err := dao.acquire(ctx); err != nil {
+		return err
+	}
+	if dao.db != nil && dao.revision == dao.projects.Revision() {
+		return nil
+	}
+	// Building is of use to later queries even if this one gives up.
+	if err := dao.build(context.WithoutCancel(ctx)); err != nil {
+		dao.release()
+		return err
+	}
+	return nil
+}
+
+// Query runs a read-only statement and returns at most maxRows rows, the
+// values of which take at most MaxQueryBytes. The statement is interrupted
+// once ctx is done.
+func (dao *DatabaseDAO) Query(ctx context.Context, query string, maxRows int) (*models.QueryResult, error) {
+	if err := dao.current(ctx); err != nil {
+		return nil, err
+	}
+	defer dao.release()
+
+	conn, err := dao.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, queryError(ctx, err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, queryError(ctx, err)
+	}
+	result := &models.QueryResult{Revision: dao.revision, Columns: columns, Rows: [][]interface{}{}}
+	size := 0
+	for rows.Next() {
+		if len(result.Rows) == maxRows {
+			result.Truncated = true
+			break
+		}
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err = rows.Scan(pointers...); err != nil {
+			return nil, queryError(ctx, err)
+		}
+		for i, value := range values {
+			switch value := value.(type) {
+			case []byte:
+				values[i] = string(value)
+				size += len(value)
+			case string:
+				size += len(value)
+			default:
+				size += 8
+			}
+		}
+		if size > MaxQueryBytes {
+			return nil, &models.QueryError{Message: fmt.Sprintf("result exceeds %d bytes", MaxQueryBytes)}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, queryError(ctx, err)
+	}
+	return result, nil
+}
+
+// queryError tells timeouts apart from broken statements.
+func queryError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return &models.QueryError{Message: err.Error()}
+}
+
+// Dump returns the database file of the current revision.
+func (dao *DatabaseDAO) Dump(ctx context.Context) ([]byte, string, error) {
+	if err := dao.current(ctx); err != nil {
+		return nil, "", err
+	}
+	defer dao.release()
+
+	var data []byte
+	err := dao.conn.Raw(func(driverConn interface{}) error {
+		serializer, ok := driverConn.(interface{ Serialize() ([]byte, error) })
+		if !ok {
+			return errors.New("database cannot be serialized")
+		}
+		var err error
+		data, err = serializer.Serialize()
+		return err
+	})
+	return data, dao.revision, err
+}
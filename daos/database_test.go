@@ -0,0 +1,99 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatabase(t *testing.T) {
+	defer withFixture(map[string]string{
+		"config/i18n_defaults.json":                 `{"frameworks/*": {"trunk_kf5": "master"}}`,
+		"projects/frameworks/metadata.yaml":         "name: Frameworks\n",
+		"projects/frameworks/solid/metadata.yaml":   "repopath: solid\nname: Solid\nrepoactive: true\nhasrepo: true\n",
+		"projects/frameworks/kdelibs/metadata.yaml": "repopath: kdelibs\nrepoactive: false\nhasrepo: true\n",
+		"projects/extragear/krita/metadata.yaml": "repopath: krita\nname: Krita\nrepoactive: true\nhasrepo: true\n" +
+			"members:\n- username: boud\n  displayname: Boudewijn\n",
+	})()
+	dao := NewDatabaseDAO(NewGitDAOInternal(false))
+	ctx := context.Background()
+
+	result, err := dao.Query(ctx, `SELECT p.toplevel, count(*) FROM projects p WHERE repoactive AND NOT EXISTS
+		(SELECT 1 FROM i18n WHERE path = p.path AND key = 'trunk_kf5' AND value != 'none')
+		GROUP BY toplevel ORDER BY toplevel`, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"toplevel", "count(*)"}, result.Columns)
+	assert.Equal(t, [][]interface{}{{"extragear", int64(1)}}, result.Rows)
+	assert.False(t, result.Truncated)
+
+	result, err = dao.Query(ctx, `SELECT username, displayname, email FROM members`, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]interface{}{{"boud", "Boudewijn", nil}}, result.Rows)
+
+	result, err = dao.Query(ctx, `SELECT path FROM projects ORDER BY path`, 2)
+	assert.NoError(t, err)
+	assert.Len(t, result.Rows, 2)
+	assert.True(t, result.Truncated)
+
+	for _, query := range []string{
+		`DELETE FROM projects`,
+		`PRAGMA query_only = OFF; DELETE FROM projects`,
+		`SELECT 1; UPDATE projects SET name = 'x'`,
+		`CREATE TABLE x (y)`,
+		`ATTACH 'other.sqlite' AS other`,
+		`SELECT * FROM nope`,
+		`SELEKT 1`,
+	} {
+		_, err = dao.Query(ctx, query, 100)
+		_, ok := err.(*models.QueryError)
+		assert.True(t, ok, query)
+	}
+	result, err = dao.Query(ctx, `SELECT count(*) FROM projects`, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), result.Rows[0][0])
+
+	_, err = dao.Query(ctx, `SELECT randomblob(100000000)`, 100)
+	assert.IsType(t, &models.QueryError{}, err)
+	_, err = dao.Query(ctx, `WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n LIMIT 100)
+		SELECT i, randomblob(1000000) FROM n`, 100)
+	assert.Equal(t, &models.QueryError{Message: "result exceeds 8388608 bytes"}, err)
+
+	// Queries do not share their connection.
+	_, err = dao.Query(ctx, `PRAGMA query_only = OFF; CREATE TEMP TABLE x AS SELECT 1`, 100)
+	assert.NoError(t, err)
+	_, err = dao.Query(ctx, `SELECT * FROM x`, 100)
+	assert.IsType(t, &models.QueryError{}, err)
+
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = dao.Query(timeout, `WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT count(*) FROM n`, 100)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	data, _, err := dao.Dump(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "SQLite format 3\x00", string(data[:16]))
+}
@@ -0,0 +1,284 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+	"github.com/danwakefield/fnmatch"
+)
+
+// DefaultBuildMetadataDir is where kde-build-metadata is checked out unless
+// configured otherwise.
+const DefaultBuildMetadataDir = "kde-build-metadata"
+
+var branchGroupPattern = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// dependencyRule is one line of a dependency-data file. The pattern may
+// use wildcards, a negated rule removes a dependency added by earlier rules.
+type dependencyRule struct {
+	pattern    string
+	dependency string
+	negated    bool
+}
+
+// dependencyGraph is the resolved dependency data of one branch group.
+type dependencyGraph struct {
+	dependencies map[models.ProjectPath][]models.ProjectPath
+	dependents   map[models.ProjectPath][]models.ProjectPath
+}
+
+// EnableBuildMetadata makes the DAO track a checkout of kde-build-metadata
+// in dir alongside repo-metadata. It is cloned and updated by UpdateClone.
+func (dao *GitDAO) EnableBuildMetadata(dir string) {
+	dao.repoMutex.Lock()
+	defer dao.repoMutex.Unlock()
+	dao.buildMetadataDir = dir
+}
+
+func (dao *GitDAO) updateBuildMetadata(ctx context.Context) (string, error) {
+	if err := dao.cloneRepo(ctx, dao.buildMetadataDir, "https://anongit.kde.org/kde-build-metadata.git"); err != nil {
+		return "", err
+	}
+	ret, err := dao.updateRepo(ctx, dao.buildMetadataDir)
+	dao.cacheMutex.Lock()
+	dao.dependencyCache = map[string]*dependencyGraph{}
+	dao.logicalModuleStructure = nil
+	dao.cacheMutex.Unlock()
+	return ret, err
+}
+
+// stripBranch drops the [branch] qualifier some entries carry.
+func stripBranch(str string) string {
+	if i := strings.Index(str, "["); i >= 0 {
+		return str[:i]
+	}
+	return str
+}
+
+func parseDependencyData(file *os.File) ([]dependencyRule, error) {
+	rules := []dependencyRule{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		parts := strings.SplitN(text, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected 'project: dependency'", file.Name(), line)
+		}
+		rule := dependencyRule{
+			pattern:    strings.Trim(stripBranch(strings.TrimSpace(parts[0])), "/"),
+			dependency: strings.TrimSpace(parts[1]),
+		}
+		if strings.HasPrefix(rule.dependency, "-") {
+			rule.negated = true
+			rule.dependency = strings.TrimSpace(rule.dependency[1:])
+		}
+		rule.dependency = strings.Trim(stripBranch(rule.dependency), "/")
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// resolveDependencies applies the rules in order to path.
+func resolveDependencies(rules []dependencyRule, path models.ProjectPath) []models.ProjectPath {
+	deps := []models.ProjectPath{}
+	for _, rule := range rules {
+		if !fnmatch.Match(rule.pattern, path.String(), 0) {
+			continue
+		}
+		dependency, err := models.ParseProjectPath(rule.dependency)
+		if err != nil || dependency == path {
+			continue
+		}
+		filtered := []models.ProjectPath{}
+		for _, dep := range deps {
+			if dep != dependency {
+				filtered = append(filtered, dep)
+			}
+		}
+		deps = filtered
+		if !rule.negated {
+			deps = append(deps, dependency)
+		}
+	}
+	return deps
+}
+
+// dependencyGraph returns the resolved graph of a branch group. It is built
+// for all projects at once and cached until either repository changes.
+func (dao *GitDAO) dependencyGraph(ctx context.Context, branchGroup string) (*dependencyGraph, error) {
+	if dao.buildMetadataDir == "" || !branchGroupPattern.MatchString(branchGroup) {
+		return nil, models.ErrUnknownBranchGroup
+	}
+	dao.cacheMutex.Lock()
+	graph := dao.dependencyCache[branchGroup]
+	dao.cacheMutex.Unlock()
+	if graph != nil {
+		return graph, nil
+	}
+
+	file, err := os.Open(filepath.Join(dao.buildMetadataDir, "dependency-data-"+branchGroup))
+	if err != nil {
+		return nil, models.ErrUnknownBranchGroup
+	}
+	defer file.Close()
+	rules, err := parseDependencyData(file)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := dao.find(ctx, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	graph = &dependencyGraph{
+		dependencies: map[models.ProjectPath][]models.ProjectPath{},
+		dependents:   map[models.ProjectPath][]models.ProjectPath{},
+	}
+	for _, path := range paths {
+		deps := resolveDependencies(rules, path)
+		graph.dependencies[path] = deps
+		for _, dep := range deps {
+			graph.dependents[dep] = append(graph.dependents[dep], path)
+		}
+	}
+
+	dao.cacheMutex.Lock()
+	dao.dependencyCache[branchGroup] = graph
+	dao.cacheMutex.Unlock()
+	return graph, nil
+}
+
+// Dependencies returns the direct dependencies of path in a branch group.
+func (dao *GitDAO) Dependencies(ctx context.Context, branchGroup string, path models.ProjectPath) ([]models.ProjectPath, error) {
+	dao.repoMutex.RLock()
+	defer dao.repoMutex.RUnlock()
+
+	graph, err := dao.dependencyGraph(ctx, branchGroup)
+	if err != nil {
+		return nil, err
+	}
+	deps, ok := graph.dependencies[path]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return deps, nil
+}
+
+// Dependents returns the projects directly depending on path in a branch
+// group.
+func (dao *GitDAO) Dependents(ctx context.Context, branchGroup string, path models.ProjectPath) ([]models.ProjectPath, error) {
+	dao.repoMutex.RLock()
+	defer dao.repoMutex.RUnlock()
+
+	graph, err := dao.dependencyGraph(ctx, branchGroup)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := graph.dependencies[path]; !ok {
+		return nil, models.ErrNotFound
+	}
+	dependents := append([]models.ProjectPath{}, graph.dependents[path]...)
+	sort.Slice(dependents, func(i, j int) bool { return dependents[i] < dependents[j] })
+	return dependents, nil
+}
+
+// BuildOrder returns paths and everything they depend on, transitively, in
+// an order in which they can be built. Dependencies always come before their
+// dependents.
+func (dao *GitDAO) BuildOrder(ctx context.Context, branchGroup string, paths []models.ProjectPath) ([]models.ProjectPath, error) {
+	dao.repoMutex.RLock()
+	defer dao.repoMutex.RUnlock()
+
+	graph, err := dao.dependencyGraph(ctx, branchGroup)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		if _, ok := graph.dependencies[path]; !ok {
+			return nil, models.ErrNotFound
+		}
+	}
+	return topologicalSort(graph.dependencies, paths)
+}
+
+// topologicalSort is a depth first search which keeps the stack around to
+// report cycles.
+func topologicalSort(dependencies map[models.ProjectPath][]models.ProjectPath, paths []models.ProjectPath) ([]models.ProjectPath, error) {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[models.ProjectPath]int{}
+	order := []models.ProjectPath{}
+	stack := []models.ProjectPath{}
+
+	var visit func(path models.ProjectPath) error
+	visit = func(path models.ProjectPath) error {
+		switch state[path] {
+		case done:
+			return nil
+		case visiting:
+			for i, entry := range stack {
+				if entry == path {
+					cycle := append([]models.ProjectPath{}, stack[i:]...)
+					return &models.CycleError{Cycle: append(cycle, path)}
+				}
+			}
+		}
+		state[path] = visiting
+		stack = append(stack, path)
+		deps := append([]models.ProjectPath{}, dependencies[path]...)
+		sort.Slice(deps, func(i, j int) bool { return deps[i] < deps[j] })
+		for _, dep := range deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[path] = done
+		order = append(order, path)
+		return nil
+	}
+
+	for _, path := range paths {
+		if err := visit(path); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
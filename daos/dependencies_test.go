@@ -0,0 +1,100 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func withDependencyFixture(data string) func() {
+	restore := withFixture(map[string]string{
+		"projects/frameworks/extra-cmake-modules/metadata.yaml": "repopath: extra-cmake-modules\n",
+		"projects/frameworks/solid/metadata.yaml":               "repopath: solid\n",
+		"projects/frameworks/kio/metadata.yaml":                 "repopath: kio\n",
+		"projects/calligra/krita/metadata.yaml":                 "repopath: krita\n",
+	})
+	os.MkdirAll("build/kde-build-metadata", 0755)
+	ioutil.WriteFile("build/kde-build-metadata/dependency-data-kf5-qt5", []byte(data), 0644)
+	return restore
+}
+
+func TestDependencies(t *testing.T) {
+	defer withDependencyFixture(`# Comment
+frameworks/*: frameworks/extra-cmake-modules
+frameworks/extra-cmake-modules: -frameworks/extra-cmake-modules
+frameworks/kio: frameworks/solid # trailing comment
+calligra/krita[master]: frameworks/kio
+calligra/krita: frameworks/solid
+calligra/krita: -frameworks/solid
+`)()
+
+	dao := NewGitDAOInternal(false)
+	dao.EnableBuildMetadata("build/kde-build-metadata")
+
+	deps, err := dao.Dependencies(context.Background(), "kf5-qt5", "frameworks/kio")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ProjectPath{"frameworks/extra-cmake-modules", "frameworks/solid"}, deps)
+
+	deps, err = dao.Dependencies(context.Background(), "kf5-qt5", "calligra/krita")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ProjectPath{"frameworks/kio"}, deps)
+
+	deps, err = dao.Dependents(context.Background(), "kf5-qt5", "frameworks/solid")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ProjectPath{"frameworks/kio"}, deps)
+
+	order, err := dao.BuildOrder(context.Background(), "kf5-qt5", []models.ProjectPath{"calligra/krita"})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ProjectPath{
+		"frameworks/extra-cmake-modules",
+		"frameworks/solid",
+		"frameworks/kio",
+		"calligra/krita",
+	}, order)
+
+	_, err = dao.Dependencies(context.Background(), "kf6", "frameworks/kio")
+	assert.Equal(t, models.ErrUnknownBranchGroup, err)
+	_, err = dao.Dependencies(context.Background(), "../x", "frameworks/kio")
+	assert.Equal(t, models.ErrUnknownBranchGroup, err)
+	_, err = dao.Dependencies(context.Background(), "kf5-qt5", "nope")
+	assert.Equal(t, models.ErrNotFound, err)
+}
+
+func TestBuildOrderCycle(t *testing.T) {
+	defer withDependencyFixture(`frameworks/kio: frameworks/solid
+frameworks/solid: calligra/krita
+calligra/krita: frameworks/kio
+`)()
+
+	dao := NewGitDAOInternal(false)
+	dao.EnableBuildMetadata("build/kde-build-metadata")
+
+	_, err := dao.BuildOrder(context.Background(), "kf5-qt5", []models.ProjectPath{"frameworks/kio"})
+	assert.Equal(t, &models.CycleError{Cycle: []models.ProjectPath{
+		"frameworks/kio", "frameworks/solid", "calligra/krita", "frameworks/kio",
+	}}, err)
+}
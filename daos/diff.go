@@ -0,0 +1,287 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+)
+
+// Diffs between two commits never change, keep some around.
+const maxDiffCache = 32
+
+// resolveRevision turns rev into a commit SHA of the clone.
+func (dao *GitDAO) resolveRevision(ctx context.Context, rev string) (string, error) {
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return "", models.ErrUnknownRevision
+	}
+	out, err := dao.git(ctx, dao.tree.dir, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return "", models.ErrUnknownRevision
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// exportRevision writes the tree of sha into a new temporary directory.
+func (dao *GitDAO) exportRevision(ctx context.Context, sha string) (string, error) {
+	dao.log(ctx).Debug("exporting revision", "revision", sha)
+	dir, err := ioutil.TempDir("", "repo-metadata-")
+	if err != nil {
+		return "", err
+	}
+	err = dao.gitStream(ctx, dao.tree.dir, nil, func(r io.Reader) error {
+		return untar(r, dir)
+	}, "archive", "--format=tar", sha)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+func untar(r io.Reader, dir string) error {
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(filepath.Separator)) {
+			continue // Nothing in git archive should do this, but still.
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeSymlink:
+			err = os.Symlink(header.Linkname, target)
+		case tar.TypeReg:
+			var file *os.File
+			file, err = os.Create(target)
+			if err == nil {
+				_, err = io.Copy(file, reader)
+				file.Close()
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// resolveAll resolves every project of a tree.
+func resolveAll(ctx context.Context, tree *metadataTree) (map[models.ProjectPath]models.Project, error) {
+	projects := map[models.ProjectPath]models.Project{}
+	err := tree.walk(func(path models.ProjectPath) error {
+		project, err := tree.newProject(ctx, path)
+		if err != nil {
+			return err
+		}
+		projects[path] = project
+		return nil
+	})
+	return projects, err
+}
+
+// resolveRevisionProjects resolves every project as of sha.
+func (dao *GitDAO) resolveRevisionProjects(ctx context.Context, sha string) (map[models.ProjectPath]models.Project, error) {
+	dir, err := dao.exportRevision(ctx, sha)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	return resolveAll(ctx, &metadataTree{dir, dao.tree.urlTemplates})
+}
+
+// flattenProject collapses nested maps into dotted keys so changes can be
+// reported per field.
+func flattenProject(prefix string, obj map[string]interface{}, into map[string]interface{}) {
+	for key, value := range obj {
+		if nested, ok := value.(map[string]interface{}); ok {
+			flattenProject(prefix+key+".", nested, into)
+			continue
+		}
+		into[prefix+key] = value
+	}
+}
+
+func fieldChanges(old models.Project, new models.Project) []models.FieldChange {
+	oldFields := map[string]interface{}{}
+	newFields := map[string]interface{}{}
+	flattenProject("", old, oldFields)
+	flattenProject("", new, newFields)
+
+	changes := []models.FieldChange{}
+	for field, oldValue := range oldFields {
+		newValue, ok := newFields[field]
+		if !ok || !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, models.FieldChange{Field: field, Old: oldValue, New: newValue})
+		}
+	}
+	for field, newValue := range newFields {
+		if _, ok := oldFields[field]; !ok {
+			changes = append(changes, models.FieldChange{Field: field, New: newValue})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+func sortPaths(paths []models.ProjectPath) {
+	sort.Slice(paths, func(i, j int) bool { return paths[i] < paths[j] })
+}
+
+// diffProjects compares two sets of resolved projects. Projects that
+// disappeared from one path and appeared at another with the same repopath
+// are moves rather than a removal and an addition.
+func diffProjects(old map[models.ProjectPath]models.Project, new map[models.ProjectPath]models.Project) *models.Diff {
+	diff := &models.Diff{
+		Added:    []models.ProjectPath{},
+		Removed:  []models.ProjectPath{},
+		Moved:    []models.Move{},
+		Modified: map[models.ProjectPath][]models.FieldChange{},
+	}
+
+	addedByRepopath := map[string]models.ProjectPath{}
+	for path, project := range new {
+		if _, ok := old[path]; ok {
+			continue
+		}
+		if repopath, ok := project["repopath"].(string); ok && repopath != "" {
+			addedByRepopath[repopath] = path
+		}
+	}
+
+	moved := map[models.ProjectPath]bool{}
+	for path, project := range old {
+		if newProject, ok := new[path]; ok {
+			if changes := fieldChanges(project, newProject); len(changes) > 0 {
+				diff.Modified[path] = changes
+			}
+			continue
+		}
+		repopath, _ := project["repopath"].(string)
+		if to, ok := addedByRepopath[repopath]; ok && repopath != "" {
+			diff.Moved = append(diff.Moved, models.Move{From: path, To: to, Repopath: repopath})
+			moved[to] = true
+			if changes := fieldChanges(project, new[to]); len(changes) > 0 {
+				diff.Modified[to] = changes
+			}
+			continue
+		}
+		diff.Removed = append(diff.Removed, path)
+	}
+	for path := range new {
+		if _, ok := old[path]; !ok && !moved[path] {
+			diff.Added = append(diff.Added, path)
+		}
+	}
+
+	sortPaths(diff.Added)
+	sortPaths(diff.Removed)
+	sort.Slice(diff.Moved, func(i, j int) bool { return diff.Moved[i].To < diff.Moved[j].To })
+	return diff
+}
+
+// resolveDiff resolves from and to, to the served revision if empty. With
+// within above 0 from must be at most within commits before to.
+func (dao *GitDAO) resolveDiff(ctx context.Context, from string, to string, within int) (string, string, error) {
+	dao.rlock(ctx)
+	defer dao.repoMutex.RUnlock()
+
+	if to == "" {
+		to = dao.revSHA
+	}
+	fromSHA, err := dao.resolveRevision(ctx, from)
+	if err != nil {
+		return "", "", err
+	}
+	toSHA, err := dao.resolveRevision(ctx, to)
+	if err != nil {
+		return "", "", err
+	}
+	if within <= 0 {
+		return fromSHA, toSHA, nil
+	}
+	out, err := dao.git(ctx, dao.tree.dir, "rev-list", "--max-count="+strconv.Itoa(within+1), toSHA)
+	if err != nil {
+		return "", "", err
+	}
+	for _, sha := range strings.Fields(out) {
+		if sha == fromSHA {
+			return fromSHA, toSHA, nil
+		}
+	}
+	return "", "", models.ErrRevisionOutOfRange
+}
+
+// Diff compares the resolved projects of two revisions of repo-metadata.
+// An empty to means the served revision. With within above 0 from must be
+// at most within commits before to.
+func (dao *GitDAO) Diff(ctx context.Context, from string, to string, within int) (*models.Diff, error) {
+	fromSHA, toSHA, err := dao.resolveDiff(ctx, from, to, within)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fromSHA + ".." + toSHA
+	dao.cacheMutex.Lock()
+	diff := dao.diffCache[key]
+	dao.cacheMutex.Unlock()
+	if diff != nil {
+		return diff, nil
+	}
+
+	// Revisions are exported by SHA, which an update cannot change, so this
+	// runs without holding updates up.
+	old, err := dao.resolveRevisionProjects(ctx, fromSHA)
+	if err != nil {
+		return nil, err
+	}
+	new, err := dao.resolveRevisionProjects(ctx, toSHA)
+	if err != nil {
+		return nil, err
+	}
+	diff = diffProjects(old, new)
+	diff.From = fromSHA
+	diff.To = toSHA
+
+	dao.cacheMutex.Lock()
+	if len(dao.diffCache) >= maxDiffCache {
+		dao.diffCache = map[string]*models.Diff{}
+	}
+	dao.diffCache[key] = diff
+	dao.cacheMutex.Unlock()
+	return diff, nil
+}
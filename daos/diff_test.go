@@ -0,0 +1,117 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func git(args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = "repo-metadata"
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.org",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.org")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		panic(string(out))
+	}
+	return string(out)
+}
+
+func TestDiff(t *testing.T) {
+	defer withFixture(map[string]string{
+		"config/i18n_defaults.json":                       `{"frameworks/*": {"trunk_kf5": "master"}}`,
+		"projects/frameworks/solid/metadata.yaml":         "repopath: solid\n",
+		"projects/extragear/graphics/krita/metadata.yaml": "repopath: krita\nname: Krita\n",
+		"projects/kde/kdelibs/metadata.yaml":              "repopath: kdelibs\n",
+	})()
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "one")
+	from := git("rev-parse", "HEAD")
+
+	ioutil.WriteFile("repo-metadata/config/i18n_defaults.json",
+		[]byte(`{"frameworks/*": {"trunk_kf5": "master", "stable_kf5": "5.38"}}`), 0644)
+	git("mv", "projects/extragear/graphics/krita", "projects/extragear/krita")
+	ioutil.WriteFile("repo-metadata/projects/extragear/krita/metadata.yaml",
+		[]byte("repopath: krita\nname: Krita Paint\n"), 0644)
+	git("rm", "-q", "-r", "projects/kde")
+	os.MkdirAll("repo-metadata/projects/frameworks/kirigami", 0755)
+	ioutil.WriteFile("repo-metadata/projects/frameworks/kirigami/metadata.yaml",
+		[]byte("repopath: kirigami\n"), 0644)
+	git("add", ".")
+	git("commit", "-q", "-m", "two")
+
+	dao := NewGitDAOInternal(false)
+	diff, err := dao.Diff(context.Background(), from[:7], "", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, dao.Revision(), diff.To)
+	assert.Equal(t, []models.ProjectPath{"frameworks/kirigami"}, diff.Added)
+	assert.Equal(t, []models.ProjectPath{"kde/kdelibs"}, diff.Removed)
+	assert.Equal(t, []models.Move{
+		{From: "extragear/graphics/krita", To: "extragear/krita", Repopath: "krita"},
+	}, diff.Moved)
+	assert.Equal(t, []models.FieldChange{
+		{Field: "i18n.stable_kf5", New: "5.38"},
+	}, diff.Modified["frameworks/solid"])
+	assert.Contains(t, diff.Modified["extragear/krita"],
+		models.FieldChange{Field: "name", Old: "Krita", New: "Krita Paint"})
+
+	_, err = dao.Diff(context.Background(), strings.TrimSpace(from), "", 1)
+	assert.NoError(t, err)
+	_, err = dao.Diff(context.Background(), dao.Revision(), strings.TrimSpace(from), 1)
+	assert.Equal(t, models.ErrRevisionOutOfRange, err)
+
+	_, err = dao.Diff(context.Background(), "--output=/tmp/x", "", 0)
+	assert.Equal(t, models.ErrUnknownRevision, err)
+	_, err = dao.Diff(context.Background(), "doesnotexist", "", 0)
+	assert.Equal(t, models.ErrUnknownRevision, err)
+}
+
+func TestExportRevisionCanceled(t *testing.T) {
+	defer withFixture(map[string]string{
+		"projects/frameworks/solid/metadata.yaml": "repopath: solid\n",
+	})()
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "one")
+	head := git("rev-parse", "HEAD")
+
+	dao := NewGitDAOInternal(false)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := dao.exportRevision(ctx, head[:40])
+	assert.Error(t, err)
+
+	dir, err := dao.exportRevision(context.Background(), head[:40])
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.FileExists(t, dir+"/projects/frameworks/solid/metadata.yaml")
+}
@@ -21,221 +21,516 @@
 package daos
 
 import (
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"anongit.kde.org/websites/api-projects-kde-org.git/logging"
 	"anongit.kde.org/websites/api-projects-kde-org.git/models"
-	"github.com/danwakefield/fnmatch"
-	"gopkg.in/yaml.v2"
+	"anongit.kde.org/websites/api-projects-kde-org.git/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type GitDAO struct {
-	pathCache   map[string]models.Project
-	revSHA      string
-	lastPoll    time.Time
-	updateMutex sync.Mutex
+	pathCache  map[models.ProjectPath]models.Project
+	cacheMutex sync.Mutex
+	tree       *metadataTree
+	// Additional sources laid over repo-metadata, lowest first.
+	layers []*layer
+	// Operator patches applied on top of all layers.
+	overrides *overrides
+	// Closed to stop watching the overrides file, nil while none is.
+	overridesStop chan struct{}
+	// Checkout of kde-build-metadata tracked next to repo-metadata, empty
+	// when it is not.
+	buildMetadataDir string
+	dependencyCache  map[string]*dependencyGraph
+	// Branch group name to cascade of branches.
+	logicalModuleStructure map[string]*globCascade
+	// Diffs by "from..to" commit SHAs. Not reset with the other caches, a
+	// diff between two commits never changes.
+	diffCache map[string]*models.Diff
+	// Stats by commit SHA, never reset either.
+	statsCache map[string]models.Stats
+	// Stats of the served projects, nil until needed.
+	currentStats *models.Stats
+	// Paths projects were moved away from, nil until needed.
+	redirects *redirectsLoad
+	// What typeahead and suggestions match against, nil until needed.
+	completion *completionIndex
+	// Redirects configured by the operator, they win over history.
+	redirectsFile map[models.ProjectPath]models.ProjectPath
+	// Persists resolved projects across restarts, may be nil.
+	store *Store
+	// Projects loaded from the store. While set they are served instead of
+	// the trees, there is no clone to resolve them from yet.
+	snapshot *snapshot
+	// Revision last written to the store. Changed with updateMutex held.
+	savedRevision string
+	revSHA        string
+	revTime       time.Time
+	lastPoll      time.Time
+	updateMutex   sync.Mutex
+	// Held for writing while the clone is changed on disk. Readers hold it
+	// for reading so they never see a half-pulled tree.
+	repoMutex sync.RWMutex
+	// Used when the context of an operation carries no logger.
+	logger *slog.Logger
 }
 
-func NewGitDAO() *GitDAO {
-	return NewGitDAOInternal(true)
-}
+// UpdateInterval is how often the clone gets updated automatically.
+const UpdateInterval = 4 * time.Minute
 
 func NewGitDAOInternal(autoUpdate bool) *GitDAO {
-	dao := &GitDAO{}
-	dao.maybeResetCache() // Always true here ;)
+	return NewGitDAO("repo-metadata", autoUpdate, slog.Default())
+}
 
-	if !autoUpdate {
-		return dao
+// NewGitDAO serves the repo-metadata checkout in dir. With autoUpdate it is
+// cloned if need be and updated every UpdateInterval.
+func NewGitDAO(dir string, autoUpdate bool, logger *slog.Logger) *GitDAO {
+	dao := &GitDAO{
+		tree:       &metadataTree{dir, DefaultURLTemplates},
+		diffCache:  map[string]*models.Diff{},
+		statsCache: map[string]models.Stats{},
+		logger:     logger,
 	}
+	dao.maybeResetCache(context.Background()) // Always true here ;)
 
-	updateTicker := time.NewTicker(4 * time.Minute)
+	if autoUpdate {
+		dao.AutoUpdate()
+	}
+	return dao
+}
+
+// AutoUpdate clones if need be and updates now and every UpdateInterval
+// from then on. Failures are logged and tried again next time.
+func (dao *GitDAO) AutoUpdate() {
+	updateTicker := time.NewTicker(UpdateInterval)
 	go func() {
+		ctx := logging.WithLogger(context.Background(), dao.logger.With("job", "update"))
 		for {
-			dao.UpdateClone()
+			dao.UpdateClone(ctx)
 			<-updateTicker.C
 		}
 	}()
+}
 
-	return dao
+// log returns the logger of ctx, falling back to the one of the DAO.
+func (dao *GitDAO) log(ctx context.Context) *slog.Logger {
+	return logging.FromContext(ctx, dao.logger)
+}
+
+// git runs a git subcommand in dir and returns its output. Failures are
+// logged with what git had to say on stderr.
+func (dao *GitDAO) git(ctx context.Context, dir string, args ...string) (string, error) {
+	return dao.gitWithInput(ctx, dir, "", args...)
 }
 
-func (dao *GitDAO) revParse() (string, error) {
-	cmd := exec.Command("git", "rev-parse", "--verify", "HEAD")
-	cmd.Dir = "repo-metadata"
-	stdoutStderr, err := cmd.CombinedOutput()
+// gitWithInput is git with input fed to the subcommand.
+func (dao *GitDAO) gitWithInput(ctx context.Context, dir string, input string, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	err := dao.gitStream(ctx, dir, strings.NewReader(input), func(r io.Reader) error {
+		_, err := stdout.ReadFrom(r)
+		return err
+	}, args...)
+	return stdout.String(), err
+}
+
+// gitStream runs a git subcommand in dir and hands its output to consume
+// while it runs. The subcommand is killed when ctx is done.
+func (dao *GitDAO) gitStream(ctx context.Context, dir string, stdin io.Reader, consume func(io.Reader) error, args ...string) error {
+	ctx, span := tracing.Tracer().Start(ctx, "git "+args[0], trace.WithAttributes(
+		attribute.String("git.dir", dir),
+		attribute.StringSlice("git.args", args)))
+	defer span.End()
+
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err == nil {
+		err = consume(stdout)
+		io.Copy(io.Discard, stdout) // let git finish should consume stop early
+		if waitErr := cmd.Wait(); err == nil {
+			err = waitErr
+		}
+	}
+	log := dao.log(ctx).With("dir", dir, "args", args, "duration", time.Since(start))
 	if err != nil {
-		return "", err
+		span.RecordError(err)
+		span.SetStatus(codes.Error, strings.TrimSpace(stderr.String()))
+		log.Debug("git failed", "error", err, "stderr", strings.TrimSpace(stderr.String()))
+		return err
 	}
-	return string(stdoutStderr), nil
+	log.Debug("git")
+	return nil
 }
 
-func (dao *GitDAO) maybeResetCache() {
-	sha, err := dao.revParse()
+func (dao *GitDAO) revParse(ctx context.Context) (string, error) {
+	out, err := dao.git(ctx, dao.tree.dir, "rev-parse", "--verify", "HEAD")
+	return strings.TrimSpace(out), err
+}
+
+func (dao *GitDAO) commitTime(ctx context.Context, dir string) (time.Time, error) {
+	out, err := dao.git(ctx, dir, "show", "--no-patch", "--format=%ct", "HEAD")
 	if err != nil {
-		dao.resetCache()
+		return time.Time{}, err
+	}
+	epoch, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(epoch, 0).UTC(), nil
+}
+
+func (dao *GitDAO) maybeResetCache(ctx context.Context) {
+	sha, err := dao.revParse(ctx)
+	if err != nil {
+		dao.resetCache(ctx)
 		return
 	}
 	if sha != dao.revSHA {
+		dao.log(ctx).Info("new revision", "from", dao.revSHA, "to", sha)
 		dao.revSHA = sha
-		dao.resetCache()
+		dao.revTime, _ = dao.commitTime(ctx, dao.tree.dir)
+		dao.resetCache(ctx)
 	}
 }
 
-func (dao *GitDAO) resetCache() {
-	fmt.Println("RESET CACHE")
-	dao.pathCache = map[string]models.Project{}
+func (dao *GitDAO) resetCache(ctx context.Context) {
+	dao.log(ctx).Debug("reset cache")
+	dao.cacheMutex.Lock()
+	defer dao.cacheMutex.Unlock()
+	dao.pathCache = map[models.ProjectPath]models.Project{}
+	dao.dependencyCache = map[string]*dependencyGraph{}
+	dao.logicalModuleStructure = nil
+	dao.redirects = nil
+	dao.completion = nil
+	dao.currentStats = nil
 }
 
-func (dao *GitDAO) UpdateClone() string {
+// UpdateClone clones or pulls all repositories and returns what git had to
+// say. Should the clone of repo-metadata be missing still, the stored
+// projects keep being served.
+func (dao *GitDAO) UpdateClone(ctx context.Context) (string, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "GitDAO.UpdateClone")
+	defer span.End()
+
 	dao.updateMutex.Lock() // Make sure we have consistent rev values.
 	defer dao.updateMutex.Unlock()
 
+	ret, err := dao.updateClone(ctx, span)
+	// Every project request wants the aliases, build them now rather than
+	// in the first request after the update.
+	dao.warmRedirects(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return ret, err
+	}
+	dao.persist(ctx)
+	return ret, nil
+}
+
+func (dao *GitDAO) updateClone(ctx context.Context, span trace.Span) (string, error) {
+	dao.repoMutex.Lock()
+	defer dao.repoMutex.Unlock()
+
 	dao.lastPoll = time.Now()
-	dao.revSHA, _ = dao.revParse() // So we definitely know where we were at.
+	if sha, err := dao.revParse(ctx); err == nil {
+		dao.revSHA = sha // So we definitely know where we were at.
+	}
+	span.SetAttributes(attribute.String("metadata.revision.before", dao.revSHA))
+	defer func() {
+		span.SetAttributes(attribute.String("metadata.revision.after", dao.revSHA))
+	}()
 
-	dao.clone()
-	ret := dao.update()
-	dao.maybeResetCache()
+	ret, err := dao.updateRepos(ctx)
+	if _, revErr := dao.revParse(ctx); dao.snapshot != nil && revErr == nil {
+		dao.log(ctx).Info("serving clone instead of stored revision")
+		dao.snapshot = nil
+		dao.revSHA = ""
+	}
+	if dao.snapshot == nil {
+		dao.maybeResetCache(ctx)
+	}
+	return ret, err
+}
 
-	return ret
+// updateRepos clones or pulls repo-metadata and whatever else is tracked,
+// stopping at the first failure.
+func (dao *GitDAO) updateRepos(ctx context.Context) (string, error) {
+	if err := dao.clone(ctx); err != nil {
+		return "", err
+	}
+	ret, err := dao.update(ctx)
+	if err != nil {
+		return ret, err
+	}
+	if dao.buildMetadataDir != "" {
+		out, err := dao.updateBuildMetadata(ctx)
+		ret += out
+		if err != nil {
+			return ret, err
+		}
+	}
+	if len(dao.layers) > 0 {
+		out, err := dao.updateLayers(ctx)
+		ret += out
+		// The revision only tracks repo-metadata, layers may have changed
+		// regardless.
+		dao.resetCache(ctx)
+		if err != nil {
+			return ret, err
+		}
+	}
+	return ret, nil
 }
 
 func (dao *GitDAO) Age() time.Duration {
 	return time.Since(dao.lastPoll)
 }
 
-func convert(i interface{}) interface{} {
-	switch x := i.(type) {
-	case map[interface{}]interface{}:
-		m2 := map[string]interface{}{}
-		for k, v := range x {
-			m2[k.(string)] = convert(v)
-		}
-		return m2
-	case []interface{}:
-		for i, v := range x {
-			x[i] = convert(v)
+// Revision is the SHA of the repo-metadata commit being served.
+func (dao *GitDAO) Revision() string {
+	dao.repoMutex.RLock()
+	defer dao.repoMutex.RUnlock()
+	return dao.revSHA
+}
+
+// RevisionTime is the commit date of Revision. It is the zero time when
+// there is no clone.
+func (dao *GitDAO) RevisionTime() time.Time {
+	dao.repoMutex.RLock()
+	defer dao.repoMutex.RUnlock()
+	return dao.revTime
+}
+
+// LastModified is when the served data last changed: the latest of the
+// commit date of Revision, the modification of the overrides file and the
+// changes of the layers.
+func (dao *GitDAO) LastModified() time.Time {
+	dao.repoMutex.RLock()
+	defer dao.repoMutex.RUnlock()
+
+	modified := dao.revTime
+	if dao.overrides != nil && dao.overrides.modTime.After(modified) {
+		modified = dao.overrides.modTime
+	}
+	for _, layer := range dao.layers {
+		if layer.modTime.After(modified) {
+			modified = layer.modTime
 		}
 	}
-	return i
+	return modified
 }
 
-func (dao *GitDAO) Get(path string) (models.Project, error) {
+// rlock takes the repo lock for reading. How long an update held it up is
+// noted on the span of ctx.
+func (dao *GitDAO) rlock(ctx context.Context) {
+	start := time.Now()
+	dao.repoMutex.RLock()
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int64("lock.wait_ms", time.Since(start).Milliseconds()),
+		attribute.String("metadata.revision", dao.revSHA))
+}
+
+// Get resolves the project at path and returns it with the revision it was
+// resolved from.
+func (dao *GitDAO) Get(ctx context.Context, path models.ProjectPath) (models.Project, string, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "GitDAO.Get", trace.WithAttributes(
+		attribute.String("project.path", path.String())))
+	defer span.End()
+
+	dao.rlock(ctx)
+	defer dao.repoMutex.RUnlock()
+	project, hit, err := dao.getCached(ctx, path)
+	span.SetAttributes(attribute.Bool("cache.hit", hit))
+	return project, dao.revSHA, err
+}
+
+func (dao *GitDAO) get(ctx context.Context, path models.ProjectPath) (models.Project, error) {
+	project, _, err := dao.getCached(ctx, path)
+	return project, err
+}
+
+// getCached is get, additionally telling whether the project was cached.
+func (dao *GitDAO) getCached(ctx context.Context, path models.ProjectPath) (models.Project, bool, error) {
+	dao.cacheMutex.Lock()
 	project := dao.pathCache[path]
+	dao.cacheMutex.Unlock()
 	if project != nil {
-		return project, nil
+		return project, true, nil
 	}
-	project, err := dao.newProject(path)
+	dao.log(ctx).Debug("cache miss", "path", path.String())
+	project, err := dao.resolve(ctx, path)
 	if err == nil {
+		dao.applyOverrides(path, project)
 		// TODO: maybe should cache pointers, foot print small enough to not matter
 		// really, but deep copy runtime implications are meh.
+		dao.cacheMutex.Lock()
 		dao.pathCache[path] = project
-		// Make sure we have an entry with leading slash in the cache as well
-		dao.pathCache["/"+path] = project
+		dao.cacheMutex.Unlock()
 	}
-	return project, err
+	return project, false, err
 }
 
-func (dao *GitDAO) i18nDefaults() (map[string]interface{}, error) {
-	obj := map[string]interface{}{}
-	i18nFile, err := os.Open("repo-metadata/config/i18n_defaults.json")
-	if err != nil { // Components and the like have no i18n data.
-		return obj, err
+// GetMany resolves a batch of project paths or repopaths. All lookups happen
+// against the same revision, an update is held off until the batch is done.
+// Projects and errors are keyed by the requested string, the revision is the
+// one they were all resolved from.
+func (dao *GitDAO) GetMany(ctx context.Context, paths []string) (map[string]models.Project, map[string]error, string) {
+	dao.repoMutex.RLock()
+	defer dao.repoMutex.RUnlock()
+
+	projects := map[string]models.Project{}
+	errs := map[string]error{}
+	for _, path := range paths {
+		project, err := dao.getByPathOrRepopath(ctx, path)
+		if err != nil {
+			errs[path] = err
+			continue
+		}
+		projects[path] = project
 	}
-	err = json.NewDecoder(i18nFile).Decode(&obj)
-	return obj, err
+	return projects, errs, dao.revSHA
 }
 
-func (dao *GitDAO) newProject(path string) (models.Project, error) {
-	if path[0] != '/' {
-		panic("expect path to start with slash")
-	}
-	fmt.Println("!!!")
-	fmt.Printf("!!! constructing new project %s !!!\n", path)
-	fmt.Println("!!!")
-	data, err := ioutil.ReadFile("repo-metadata/projects/" + path + "/metadata.yaml")
+// GetAll resolves every project and returns them with the revision they
+// are from.
+func (dao *GitDAO) GetAll(ctx context.Context) (map[models.ProjectPath]models.Project, string, error) {
+	dao.rlock(ctx)
+	defer dao.repoMutex.RUnlock()
+	projects, err := dao.getAll(ctx)
+	return projects, dao.revSHA, err
+}
+
+func (dao *GitDAO) getAll(ctx context.Context) (map[models.ProjectPath]models.Project, error) {
+	projects := map[models.ProjectPath]models.Project{}
+	err := dao.walk(func(path models.ProjectPath) error {
+		project, err := dao.get(ctx, path)
+		if err != nil {
+			return err
+		}
+		projects[path] = project
+		return nil
+	})
+	return projects, err
+}
+
+func (dao *GitDAO) getByPathOrRepopath(ctx context.Context, str string) (models.Project, error) {
+	path, err := models.ParseProjectPath(str)
 	if err != nil {
-		return nil, err
+		return nil, models.ErrNotFound
 	}
-	var body interface{}
-	if err = yaml.Unmarshal([]byte(data), &body); err != nil {
-		return nil, err
+	if dao.isProject(path) {
+		return dao.get(ctx, path)
 	}
-	jsonData, err := json.Marshal(convert(body))
+	matches, err := dao.find(ctx, "", str)
 	if err != nil {
 		return nil, err
 	}
+	if len(matches) == 0 {
+		return nil, models.ErrNotFound
+	}
+	return dao.get(ctx, matches[0])
+}
 
-	// Patch i18n in, it's a separate file but why that is nobody knows.
-	// Put it in an i18n property on the return object.
-	jsonObj := models.Project{}
-	json.Unmarshal([]byte(jsonData), &jsonObj)
+// Find returns the paths of all projects matching the id (basename) and
+// repopath constraints. Empty constraints match everything.
+func (dao *GitDAO) Find(ctx context.Context, id string, repopath string) ([]models.ProjectPath, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "GitDAO.Find", trace.WithAttributes(
+		attribute.String("find.id", id),
+		attribute.String("find.repopath", repopath)))
+	defer span.End()
+
+	dao.rlock(ctx)
+	defer dao.repoMutex.RUnlock()
+	matches, err := dao.find(ctx, id, repopath)
+	span.SetAttributes(attribute.Int("find.matches", len(matches)))
+	return matches, err
+}
 
-	// TODO: cache
-	i18nJSONObj := map[string]interface{}{}
-	// First use default values
-	i18nDefaults, _ := dao.i18nDefaults()
-	// NOTE: Documentation of repo-metadata says the entires in the json must
-	// be ordered so we'll rely on this here.
-	for pattern, values := range i18nDefaults {
-		if !fnmatch.Match("/"+pattern, path, 0) {
-			continue
-		}
-		fmt.Println(path)
-		fmt.Println("/" + pattern)
-		fmt.Println(fnmatch.Match("/"+pattern, path, 0))
-		i18nJSONObj = values.(map[string]interface{})
-		break
-	}
-
-	// Then patch sepcific project data in if available. This cascades the
-	// attributes, e.g. if there's x and y in the defaults, the specific data may
-	// specify only y to override y but leave x at the default.
-	i18nFile, err := os.Open("repo-metadata/projects/" + path + "/i18n.json")
-	if err == nil { // Components and the like have no i18n data.
-		var i18nOverridesJSONObj map[string]interface{}
-		if err = json.NewDecoder(i18nFile).Decode(&i18nOverridesJSONObj); err != nil {
-			panic(err)
+// Children returns the paths of the projects directly below path.
+func (dao *GitDAO) Children(ctx context.Context, path models.ProjectPath) ([]models.ProjectPath, error) {
+	dao.repoMutex.RLock()
+	defer dao.repoMutex.RUnlock()
+	return dao.children(path)
+}
+
+func (dao *GitDAO) find(ctx context.Context, id string, repopath string) ([]models.ProjectPath, error) {
+	matches := []models.ProjectPath{}
+	err := dao.walk(func(path models.ProjectPath) error {
+		if len(id) != 0 && path.Name() != id {
+			return nil // Doesn't match id constraint
 		}
-		for k, v := range i18nOverridesJSONObj {
-			fmt.Printf("  OVERIDE %s ~~> %s\n", k, v)
-			i18nJSONObj[k] = v
+		if len(repopath) != 0 {
+			model, err := dao.get(ctx, path)
+			if err != nil {
+				return err
+			}
+			if model["repopath"] != repopath {
+				return nil // doesn't match repopath constraint
+			}
 		}
-	}
-	fmt.Println(i18nJSONObj)
-
-	// TODO: not cascading urls_gitrepo or urls_webaccess, useless.
-	// This data patching is too depressing for me.
+		matches = append(matches, path)
+		return nil
+	})
+	return matches, err
+}
 
-	jsonObj["i18n"] = i18nJSONObj
+func (dao *GitDAO) clone(ctx context.Context) error {
+	return dao.cloneRepo(ctx, dao.tree.dir, "https://anongit.kde.org/sysadmin/repo-metadata.git")
+}
 
-	return jsonObj, nil
+func (dao *GitDAO) update(ctx context.Context) (string, error) {
+	return dao.updateRepo(ctx, dao.tree.dir)
 }
 
-func (dao *GitDAO) clone() {
-	_, err := os.Stat("repo-metadata")
+func (dao *GitDAO) cloneRepo(ctx context.Context, dir string, url string) error {
+	_, err := os.Stat(dir)
 	if err == nil {
-		return // exists already
+		return nil // exists already
 	}
-	cmd := exec.Command("git", "clone", "--depth=1", "https://anongit.kde.org/sysadmin/repo-metadata.git")
-	stdoutStderr, err := cmd.CombinedOutput()
-	if err != nil {
-		fmt.Println(string(stdoutStderr))
-		panic(err)
+	dao.log(ctx).Info("cloning", "dir", dir, "url", url)
+	// Full history, diffs look at older revisions.
+	if _, err = dao.git(ctx, ".", "clone", url, dir); err != nil {
+		dao.log(ctx).Error("clone failed", "dir", dir, "url", url, "error", err)
+		return err
 	}
+	return nil
 }
 
-func (dao *GitDAO) update() string {
-	cmd := exec.Command("git", "pull")
-	cmd.Dir = "repo-metadata"
-	stdoutStderr, err := cmd.CombinedOutput()
+func (dao *GitDAO) updateRepo(ctx context.Context, dir string) (string, error) {
+	// Clones used to be shallow.
+	if _, err := os.Stat(filepath.Join(dir, ".git/shallow")); err == nil {
+		if _, err = dao.git(ctx, dir, "fetch", "--unshallow"); err != nil {
+			dao.log(ctx).Error("unshallow failed", "dir", dir, "error", err)
+			return "", err
+		}
+	}
+	out, err := dao.git(ctx, dir, "pull")
 	if err != nil {
-		panic(err)
+		dao.log(ctx).Error("pull failed", "dir", dir, "error", err)
+		return out, err
 	}
-	return string(stdoutStderr)
+	dao.log(ctx).Info("pulled", "dir", dir)
+	return out, nil
 }
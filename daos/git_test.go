@@ -21,12 +21,15 @@
 package daos
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -47,7 +50,7 @@ func TestGitUpdateClone(t *testing.T) {
 	assert.Error(t, err)
 
 	dao := NewGitDAOInternal(false)
-	dao.UpdateClone()
+	dao.UpdateClone(context.Background())
 
 	// Clone now
 	pwd, _ = os.Getwd()
@@ -67,9 +70,9 @@ func TestGitGet(t *testing.T) {
 	}()
 
 	dao := NewGitDAOInternal(false)
-	dao.UpdateClone()
+	dao.UpdateClone(context.Background())
 
-	project, err := dao.Get("/frameworks/solid")
+	project, _, err := dao.Get(context.Background(), "frameworks/solid")
 
 	assert.NoError(t, err)
 	assert.NotNil(t, project)
@@ -82,3 +85,116 @@ func TestGitGet(t *testing.T) {
 	assert.Equal(t, "master", i18n["trunk_kf5"])
 	assert.Equal(t, "none", i18n["stable_kf5"])
 }
+
+// withFixture changes into a temporary directory containing a repo-metadata
+// tree made up of files. The returned func restores the previous state.
+func withFixture(files map[string]string) func() {
+	tmpdir, _ := ioutil.TempDir("", "")
+	pwd, _ := os.Getwd()
+	os.Chdir(tmpdir)
+	for path, content := range files {
+		path = filepath.Join("repo-metadata", path)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte(content), 0644)
+	}
+	return func() {
+		os.Chdir(pwd)
+		os.RemoveAll(tmpdir)
+	}
+}
+
+func TestGitGetMany(t *testing.T) {
+	defer withFixture(map[string]string{
+		"projects/frameworks/solid/metadata.yaml": "repopath: solid\n",
+		"projects/calligra/krita/metadata.yaml":   "repopath: krita\n",
+	})()
+
+	dao := NewGitDAOInternal(false)
+	projects, errs, _ := dao.GetMany(context.Background(), []string{"frameworks/solid", "krita", "nope", "../x"})
+
+	assert.Len(t, projects, 2)
+	assert.Equal(t, "solid", projects["frameworks/solid"]["repopath"])
+	assert.Equal(t, "krita", projects["krita"]["repopath"])
+	assert.Len(t, errs, 2)
+	assert.Equal(t, models.ErrNotFound, errs["nope"])
+	assert.Equal(t, models.ErrNotFound, errs["../x"])
+}
+
+func TestGitChildren(t *testing.T) {
+	defer withFixture(map[string]string{
+		"projects/calligra/metadata.yaml":         "repopath: calligra\n",
+		"projects/calligra/krita/metadata.yaml":   "repopath: krita\n",
+		"projects/calligra/krita/i18n.json":       "{}\n",
+		"projects/calligra/notaproject/README.md": "\n",
+	})()
+
+	dao := NewGitDAOInternal(false)
+	children, err := dao.Children(context.Background(), "calligra")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ProjectPath{"calligra/krita"}, children)
+}
+
+func TestGitGetRejectsSymlinkEscape(t *testing.T) {
+	defer withFixture(map[string]string{
+		"projects/calligra/krita/metadata.yaml": "repopath: krita\n",
+		"outside/metadata.yaml":                 "repopath: outside\n",
+	})()
+	pwd, _ := os.Getwd()
+	os.Symlink(filepath.Join(pwd, "repo-metadata/outside"), "repo-metadata/projects/evil")
+	os.Symlink("krita", "repo-metadata/projects/calligra/alias")
+
+	dao := NewGitDAOInternal(false)
+	_, _, err := dao.Get(context.Background(), "evil")
+	assert.Equal(t, models.ErrInvalidPath, err)
+
+	// Symlinks within the projects directory are fine though.
+	project, _, err := dao.Get(context.Background(), "calligra/alias")
+	assert.NoError(t, err)
+	assert.Equal(t, "krita", project["repopath"])
+}
+
+func TestGitCascadeURLs(t *testing.T) {
+	defer withFixture(map[string]string{
+		"projects/extragear/metadata.yaml": "urls:\n  browse: https://example.org/{name}\n",
+		"projects/extragear/graphics/krita/metadata.yaml": "repopath: krita\n" +
+			"urls_gitrepo: https://example.com/krita.git\n",
+		"projects/extragear/graphics/kphotoalbum/metadata.yaml": "repopath: kphotoalbum\n",
+		"projects/extragear/metadata-only/metadata.yaml":        "hasrepo: false\n",
+		"projects/calligra/metadata.yaml": "repopath: calligra\n" +
+			"urls_gitrepo: https://example.com/calligra.git\n",
+		"projects/calligra/krita/metadata.yaml": "repopath: krita\n",
+	})()
+
+	dao := NewGitDAOInternal(false)
+	dao.SetURLTemplates(URLTemplates{"bugs": "https://bugs.example.org/{repopath}"})
+
+	project, _, err := dao.Get(context.Background(), "extragear/graphics/krita")
+	assert.NoError(t, err)
+	urls := project["urls"].(map[string]interface{})
+	assert.Equal(t, "https://example.com/krita.git", urls["clone"])
+	assert.Equal(t, "https://example.org/krita", urls["browse"])
+	assert.Equal(t, "https://bugs.example.org/krita", urls["bugs"])
+	assert.Equal(t, "git@git.kde.org:krita.git", urls["push"])
+
+	project, _, err = dao.Get(context.Background(), "extragear/graphics/kphotoalbum")
+	assert.NoError(t, err)
+	urls = project["urls"].(map[string]interface{})
+	assert.Equal(t, "https://anongit.kde.org/kphotoalbum.git", urls["clone"])
+	assert.Equal(t, "https://example.org/kphotoalbum", urls["browse"])
+
+	project, _, err = dao.Get(context.Background(), "extragear/metadata-only")
+	assert.NoError(t, err)
+	urls = project["urls"].(map[string]interface{})
+	assert.NotContains(t, urls, "clone")
+	assert.Equal(t, "https://api.kde.org/extragear/metadata-only/html/index.html", urls["apidocs"])
+
+	// A repo nested in another keeps its own url, the literal one of the
+	// parent is no template.
+	project, _, err = dao.Get(context.Background(), "calligra")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/calligra.git", project["urls"].(map[string]interface{})["clone"])
+	project, _, err = dao.Get(context.Background(), "calligra/krita")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://anongit.kde.org/krita.git", project["urls"].(map[string]interface{})["clone"])
+}
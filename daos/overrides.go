@@ -0,0 +1,180 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/logging"
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Name of the overrides in provenance data.
+const overridesLayer = "overrides"
+
+// How often the overrides file is checked for changes.
+const overridesInterval = 10 * time.Second
+
+// overrides are operator patches of project fields, read from a yaml file
+// mapping project paths to fields:
+//
+//	frameworks/solid:
+//	  repoactive: false
+type overrides struct {
+	file    string
+	modTime time.Time
+	fields  map[models.ProjectPath]models.Project
+}
+
+func readOverrides(file string) (map[models.ProjectPath]models.Project, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return map[models.ProjectPath]models.Project{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]map[interface{}]interface{}
+	if err = yaml.Unmarshal(data, &body); err != nil {
+		return nil, err
+	}
+	fields := map[models.ProjectPath]models.Project{}
+	for str, object := range body {
+		path, err := models.ParseProjectPath(str)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", str, err)
+		}
+		fields[path] = models.Project(convert(object).(map[string]interface{}))
+	}
+	return fields, nil
+}
+
+// SetOverridesFile applies the overrides in file to all projects. The file
+// is reloaded when it changes, until another file is set. A missing file
+// means no overrides.
+func (dao *GitDAO) SetOverridesFile(file string) error {
+	fields, err := readOverrides(file)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(file)
+	modTime := time.Time{}
+	if err == nil {
+		modTime = info.ModTime()
+	}
+
+	stop := make(chan struct{})
+	dao.repoMutex.Lock()
+	if dao.overridesStop != nil {
+		close(dao.overridesStop)
+	}
+	dao.overrides = &overrides{file, modTime, fields}
+	dao.overridesStop = stop
+	dao.resetCache(context.Background())
+	dao.repoMutex.Unlock()
+
+	ticker := time.NewTicker(overridesInterval)
+	go func() {
+		defer ticker.Stop()
+		ctx := logging.WithLogger(context.Background(), dao.logger.With("job", "overrides"))
+		for {
+			select {
+			case <-ticker.C:
+				dao.reloadOverrides(ctx)
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// reloadOverrides rereads the overrides file if it changed since it was
+// last read. A broken file keeps the previous overrides in place.
+func (dao *GitDAO) reloadOverrides(ctx context.Context) {
+	dao.repoMutex.RLock()
+	file := dao.overrides.file
+	modTime := dao.overrides.modTime
+	dao.repoMutex.RUnlock()
+
+	newModTime := time.Time{}
+	if info, err := os.Stat(file); err == nil {
+		newModTime = info.ModTime()
+	}
+	if newModTime.Equal(modTime) {
+		return
+	}
+	fields, err := readOverrides(file)
+	if err != nil {
+		dao.log(ctx).Error("failed to reload overrides", "file", file, "error", err)
+		return
+	}
+
+	dao.repoMutex.Lock()
+	defer dao.repoMutex.Unlock()
+	dao.overrides = &overrides{file, newModTime, fields}
+	dao.log(ctx).Info("reloaded overrides", "file", file)
+	dao.resetCache(ctx)
+}
+
+// applyOverrides patches the resolved project.
+func (dao *GitDAO) applyOverrides(path models.ProjectPath, project models.Project) {
+	if dao.overrides == nil {
+		return
+	}
+	fields, ok := dao.overrides.fields[path]
+	if !ok {
+		return
+	}
+	mergeFields(project, fields)
+	_, repopathSet := fields["repopath"]
+	_, urlsSet := fields["urls"]
+	if repopathSet && !urlsSet {
+		project["urls"] = dao.tree.cascadeURLs(path, project)
+	}
+	if provenance, ok := project["provenance"].(map[string]string); ok {
+		recordProvenance(fields, overridesLayer, provenance)
+	}
+}
+
+// Overridden returns the sorted names of the fields of path that are patched
+// by the overrides.
+func (dao *GitDAO) Overridden(path models.ProjectPath) []string {
+	dao.repoMutex.RLock()
+	defer dao.repoMutex.RUnlock()
+
+	names := []string{}
+	if dao.overrides == nil {
+		return names
+	}
+	for name := range dao.overrides.fields[path] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
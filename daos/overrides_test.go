@@ -0,0 +1,81 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverrides(t *testing.T) {
+	defer withFixture(map[string]string{
+		"projects/frameworks/metadata.yaml":       "name: Frameworks\n",
+		"projects/frameworks/solid/metadata.yaml": "repopath: solid\nname: Solid\nrepoactive: true\n",
+	})()
+	ioutil.WriteFile("overrides.yaml", []byte("frameworks/solid:\n  repoactive: false\n  i18n:\n    stable_kf5: none\n"), 0644)
+
+	dao := NewGitDAOInternal(false)
+	assert.NoError(t, dao.SetOverridesFile("overrides.yaml"))
+
+	project, _, err := dao.Get(context.Background(), "frameworks/solid")
+	assert.NoError(t, err)
+	assert.Equal(t, false, project["repoactive"])
+	assert.Equal(t, "Solid", project["name"])
+	assert.Equal(t, "none", project["i18n"].(map[string]interface{})["stable_kf5"])
+	assert.Equal(t, []string{"i18n", "repoactive"}, dao.Overridden("frameworks/solid"))
+	assert.Equal(t, []string{}, dao.Overridden("frameworks"))
+
+	// Reloaded on change.
+	ioutil.WriteFile("overrides.yaml", []byte("frameworks/solid:\n  repopath: solid-ng\n"), 0644)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes("overrides.yaml", future, future)
+	dao.reloadOverrides(context.Background())
+	assert.WithinDuration(t, future, dao.LastModified(), time.Second)
+	project, _, err = dao.Get(context.Background(), "frameworks/solid")
+	assert.NoError(t, err)
+	assert.Equal(t, true, project["repoactive"])
+	assert.Equal(t, "solid-ng", project["repopath"])
+	assert.Equal(t, "https://anongit.kde.org/solid-ng.git", project["urls"].(map[string]interface{})["clone"])
+
+	// A broken file keeps the previous overrides.
+	ioutil.WriteFile("overrides.yaml", []byte("frameworks/solid: [\n"), 0644)
+	future = future.Add(time.Minute)
+	os.Chtimes("overrides.yaml", future, future)
+	dao.reloadOverrides(context.Background())
+	assert.Equal(t, []string{"repopath"}, dao.Overridden("frameworks/solid"))
+
+	// Removing the file removes the overrides.
+	os.Remove("overrides.yaml")
+	dao.reloadOverrides(context.Background())
+	assert.Equal(t, []string{}, dao.Overridden("frameworks/solid"))
+
+	// Setting another file stops watching the previous one.
+	stop := dao.overridesStop
+	assert.NoError(t, dao.SetOverridesFile("other.yaml"))
+	_, open := <-stop
+	assert.False(t, open)
+	assert.NotEqual(t, stop, dao.overridesStop)
+}
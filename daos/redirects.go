@@ -0,0 +1,269 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"gopkg.in/yaml.v2"
+)
+
+// redirects map the paths projects used to be at to where they are now.
+// Moves are found in the history of repo-metadata: a project whose
+// metadata.yaml got deleted was moved if a project with its repopath exists
+// now. A redirects file may add to or correct them.
+type redirects struct {
+	targets map[models.ProjectPath]models.ProjectPath
+	// Former paths by current path, sorted.
+	aliases map[models.ProjectPath][]models.ProjectPath
+}
+
+// readRedirects reads a yaml file mapping old paths to new paths:
+//
+//	extragear/graphics/krita: calligra/krita
+func readRedirects(file string) (map[models.ProjectPath]models.ProjectPath, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]string
+	if err = yaml.Unmarshal(data, &body); err != nil {
+		return nil, err
+	}
+	targets := map[models.ProjectPath]models.ProjectPath{}
+	for from, to := range body {
+		fromPath, err := models.ParseProjectPath(from)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", from, err)
+		}
+		toPath, err := models.ParseProjectPath(to)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", to, err)
+		}
+		targets[fromPath] = toPath
+	}
+	return targets, nil
+}
+
+// SetRedirectsFile adds the redirects in file to those found in history.
+func (dao *GitDAO) SetRedirectsFile(file string) error {
+	targets, err := readRedirects(file)
+	if err != nil {
+		return err
+	}
+	dao.repoMutex.Lock()
+	defer dao.repoMutex.Unlock()
+	dao.redirectsFile = targets
+	dao.resetCache(context.Background())
+	return nil
+}
+
+// deletedRepopaths returns the paths of all projects deleted in the history
+// with the repopath they had, the most recent deletion wins.
+func (dao *GitDAO) deletedRepopaths(ctx context.Context) (map[models.ProjectPath]string, error) {
+	out, err := dao.git(ctx, dao.tree.dir, "log", "--no-renames", "--diff-filter=D",
+		"--name-only", "--format=%x00%H", "--", "projects")
+	if err != nil {
+		return nil, err
+	}
+
+	// The blobs as they were before the deleting commits.
+	var objects []string
+	var paths []models.ProjectPath
+	seen := map[models.ProjectPath]bool{}
+	for _, commit := range strings.Split(out, "\x00") {
+		lines := strings.Split(strings.TrimSpace(commit), "\n")
+		for _, file := range lines[1:] {
+			dir, name := path.Split(file)
+			if name != "metadata.yaml" || !strings.HasPrefix(dir, "projects/") {
+				continue
+			}
+			projectPath, err := models.ParseProjectPath(strings.TrimPrefix(dir, "projects/"))
+			if err != nil || seen[projectPath] {
+				continue
+			}
+			seen[projectPath] = true
+			objects = append(objects, lines[0]+"^:"+file)
+			paths = append(paths, projectPath)
+		}
+	}
+	if len(objects) == 0 {
+		return map[models.ProjectPath]string{}, nil
+	}
+
+	out, err = dao.gitWithInput(ctx, dao.tree.dir, strings.Join(objects, "\n")+"\n", "cat-file", "--batch")
+	if err != nil {
+		return nil, err
+	}
+	repopaths := map[models.ProjectPath]string{}
+	reader := bufio.NewReader(strings.NewReader(out))
+	for _, projectPath := range paths {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			continue // missing
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+1) // Content is followed by a newline.
+		if _, err = io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		var metadata struct {
+			Repopath string `yaml:"repopath"`
+		}
+		if yaml.Unmarshal(data, &metadata) == nil && metadata.Repopath != "" {
+			repopaths[projectPath] = metadata.Repopath
+		}
+	}
+	return repopaths, nil
+}
+
+func (dao *GitDAO) loadRedirects(ctx context.Context) (*redirects, error) {
+	current := map[string]models.ProjectPath{}
+	err := dao.walk(func(path models.ProjectPath) error {
+		project, err := dao.get(ctx, path)
+		if err != nil {
+			return err
+		}
+		if repopath, ok := project["repopath"].(string); ok {
+			current[repopath] = path
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	targets := map[models.ProjectPath]models.ProjectPath{}
+	deleted, err := dao.deletedRepopaths(ctx)
+	if err != nil {
+		// Without a clone there is no history, only the file.
+		dao.log(ctx).Warn("cannot look for moves in history", "error", err)
+	}
+	for from, repopath := range deleted {
+		if to, ok := current[repopath]; ok && to != from {
+			targets[from] = to
+		}
+	}
+	for from, to := range dao.redirectsFile {
+		targets[from] = to
+	}
+
+	r := &redirects{map[models.ProjectPath]models.ProjectPath{}, map[models.ProjectPath][]models.ProjectPath{}}
+	for from, to := range targets {
+		if dao.isProject(from) {
+			continue // Something new took the place.
+		}
+		// Follow redirects to redirects, the file may leave chains.
+		for i := 0; i < len(targets) && !dao.isProject(to); i++ {
+			next, ok := targets[to]
+			if !ok {
+				break
+			}
+			to = next
+		}
+		if !dao.isProject(to) {
+			continue
+		}
+		r.targets[from] = to
+		r.aliases[to] = append(r.aliases[to], from)
+	}
+	for _, aliases := range r.aliases {
+		sortPaths(aliases)
+	}
+	return r, nil
+}
+
+// redirectsLoad loads the redirects of a revision once, however many
+// requests need them at the same time.
+type redirectsLoad struct {
+	once      sync.Once
+	redirects *redirects
+	err       error
+}
+
+// getRedirects returns the redirects of the revision, the caller holds the
+// repo lock for reading.
+func (dao *GitDAO) getRedirects(ctx context.Context) (*redirects, error) {
+	dao.cacheMutex.Lock()
+	load := dao.redirects
+	if load == nil {
+		load = &redirectsLoad{}
+		dao.redirects = load
+	}
+	dao.cacheMutex.Unlock()
+	// Loading is of use to the others waiting even if this caller gives up.
+	load.once.Do(func() {
+		load.redirects, load.err = dao.loadRedirects(context.WithoutCancel(ctx))
+	})
+	return load.redirects, load.err
+}
+
+// warmRedirects loads the redirects of the revision unless they are loaded
+// already.
+func (dao *GitDAO) warmRedirects(ctx context.Context) {
+	dao.rlock(ctx)
+	defer dao.repoMutex.RUnlock()
+	if _, err := dao.getRedirects(ctx); err != nil {
+		dao.log(ctx).Error("failed to load redirects", "error", err)
+	}
+}
+
+// Redirect returns where the project that used to be at path is now.
+func (dao *GitDAO) Redirect(ctx context.Context, path models.ProjectPath) (models.ProjectPath, bool) {
+	dao.rlock(ctx)
+	defer dao.repoMutex.RUnlock()
+	r, err := dao.getRedirects(ctx)
+	if err != nil {
+		dao.log(ctx).Error("failed to load redirects", "error", err)
+		return "", false
+	}
+	to, ok := r.targets[path]
+	return to, ok
+}
+
+// Aliases returns the paths the project at path used to be at.
+func (dao *GitDAO) Aliases(ctx context.Context, path models.ProjectPath) []models.ProjectPath {
+	dao.rlock(ctx)
+	defer dao.repoMutex.RUnlock()
+	r, err := dao.getRedirects(ctx)
+	if err != nil {
+		dao.log(ctx).Error("failed to load redirects", "error", err)
+		return []models.ProjectPath{}
+	}
+	return append([]models.ProjectPath{}, r.aliases[path]...)
+}
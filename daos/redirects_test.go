@@ -0,0 +1,107 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirects(t *testing.T) {
+	defer withFixture(map[string]string{
+		"projects/frameworks/solid/metadata.yaml":         "repopath: solid\n",
+		"projects/extragear/graphics/krita/metadata.yaml": "repopath: krita\n",
+		"projects/kde/kdelibs/metadata.yaml":              "repopath: kdelibs\n",
+	})()
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "one")
+	git("mv", "projects/extragear/graphics/krita", "projects/extragear/krita")
+	git("rm", "-q", "-r", "projects/kde")
+	git("commit", "-q", "-m", "two")
+	os.MkdirAll("repo-metadata/projects/graphics", 0755)
+	git("mv", "projects/extragear/krita", "projects/graphics/krita")
+	git("commit", "-q", "-m", "three")
+
+	ctx := context.Background()
+	dao := NewGitDAOInternal(false)
+	to, ok := dao.Redirect(ctx, "extragear/graphics/krita")
+	assert.True(t, ok)
+	assert.Equal(t, models.ProjectPath("graphics/krita"), to)
+	to, ok = dao.Redirect(ctx, "extragear/krita")
+	assert.True(t, ok)
+	assert.Equal(t, models.ProjectPath("graphics/krita"), to)
+	_, ok = dao.Redirect(ctx, "kde/kdelibs")
+	assert.False(t, ok, "deleted without a successor")
+	_, ok = dao.Redirect(ctx, "frameworks/solid")
+	assert.False(t, ok)
+	assert.Equal(t, []models.ProjectPath{"extragear/graphics/krita", "extragear/krita"},
+		dao.Aliases(ctx, "graphics/krita"))
+	assert.Equal(t, []models.ProjectPath{}, dao.Aliases(ctx, "frameworks/solid"))
+
+	// Loaded once per revision, however many ask at the same time.
+	dao.resetCache(ctx)
+	loaded := make(chan *redirects, 8)
+	for i := 0; i < cap(loaded); i++ {
+		go func() {
+			dao.rlock(ctx)
+			defer dao.repoMutex.RUnlock()
+			r, _ := dao.getRedirects(ctx)
+			loaded <- r
+		}()
+	}
+	first := <-loaded
+	for i := 1; i < cap(loaded); i++ {
+		assert.Same(t, first, <-loaded)
+	}
+
+	// Updates load them before requests need them.
+	dao.resetCache(ctx)
+	dao.warmRedirects(ctx)
+	assert.NotNil(t, dao.redirects)
+	assert.NotNil(t, dao.redirects.redirects)
+
+	ioutil.WriteFile("redirects.yaml", []byte(
+		"kde/kdelibs: frameworks/solid\n"+
+			"kde/solid: kde/kdelibs\n"+
+			"extragear/krita: frameworks/solid\n"+
+			"does/not: exist/either\n"), 0644)
+	assert.NoError(t, dao.SetRedirectsFile("redirects.yaml"))
+	to, ok = dao.Redirect(ctx, "kde/kdelibs")
+	assert.True(t, ok)
+	assert.Equal(t, models.ProjectPath("frameworks/solid"), to)
+	to, ok = dao.Redirect(ctx, "kde/solid")
+	assert.True(t, ok, "chains are followed")
+	assert.Equal(t, models.ProjectPath("frameworks/solid"), to)
+	to, ok = dao.Redirect(ctx, "extragear/krita")
+	assert.True(t, ok)
+	assert.Equal(t, models.ProjectPath("frameworks/solid"), to, "the file wins over history")
+	_, ok = dao.Redirect(ctx, "does/not")
+	assert.False(t, ok, "redirects must end at a project")
+
+	ioutil.WriteFile("bad.yaml", []byte("../etc: frameworks/solid\n"), 0644)
+	assert.Error(t, dao.SetRedirectsFile("bad.yaml"))
+}
@@ -0,0 +1,311 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+)
+
+// Name of the repo-metadata layer in provenance data.
+const upstreamLayer = "repo-metadata"
+
+// Source is an additional metadata layer laid over repo-metadata. It has the
+// same layout as repo-metadata. With a URL it is a git repository cloned to
+// and updated in Dir, without it Dir is used as is.
+type Source struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	Dir  string `json:"dir"`
+}
+
+type layer struct {
+	source Source
+	tree   *metadataTree
+	// When the layer last changed, see layerTime.
+	modTime time.Time
+}
+
+// AddSource lays source over all previously added layers. Fields set in it
+// override fields of lower layers, projects only in it are added.
+func (dao *GitDAO) AddSource(source Source) {
+	dao.repoMutex.Lock()
+	defer dao.repoMutex.Unlock()
+
+	ctx := context.Background()
+	layer := &layer{source: source, tree: &metadataTree{source.Dir, dao.tree.urlTemplates}}
+	layer.modTime = dao.layerTime(ctx, layer)
+	dao.layers = append(dao.layers, layer)
+	dao.resetCache(ctx)
+}
+
+// layerTime is when layer last changed: the commit date of git backed
+// layers, the newest modification of a file or directory in Dir otherwise.
+// It is the zero time while there is nothing in Dir.
+func (dao *GitDAO) layerTime(ctx context.Context, layer *layer) time.Time {
+	if layer.source.URL != "" {
+		modTime, _ := dao.commitTime(ctx, layer.source.Dir)
+		return modTime
+	}
+	modTime := time.Time{}
+	filepath.Walk(layer.source.Dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+		return nil
+	})
+	return modTime
+}
+
+// updateLayers updates the git backed layers.
+func (dao *GitDAO) updateLayers(ctx context.Context) (string, error) {
+	ret := ""
+	for _, layer := range dao.layers {
+		if layer.source.URL == "" {
+			layer.modTime = dao.layerTime(ctx, layer)
+			continue
+		}
+		if err := dao.cloneRepo(ctx, layer.source.Dir, layer.source.URL); err != nil {
+			return ret, err
+		}
+		out, err := dao.updateRepo(ctx, layer.source.Dir)
+		ret += out
+		if err != nil {
+			return ret, err
+		}
+		layer.modTime = dao.layerTime(ctx, layer)
+	}
+	return ret, nil
+}
+
+// trees returns repo-metadata and all layers in order of precedence, lowest
+// first.
+func (dao *GitDAO) trees() []*metadataTree {
+	trees := []*metadataTree{dao.tree}
+	for _, layer := range dao.layers {
+		trees = append(trees, layer.tree)
+	}
+	return trees
+}
+
+func (dao *GitDAO) layerName(i int) string {
+	if i == 0 {
+		return upstreamLayer
+	}
+	return dao.layers[i-1].source.Name
+}
+
+func (dao *GitDAO) isProject(path models.ProjectPath) bool {
+	if dao.snapshot != nil {
+		_, ok := dao.snapshot.projects[path]
+		return ok
+	}
+	for _, tree := range dao.trees() {
+		if tree.isProject(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// walk calls fn for every project of any layer, in path order.
+func (dao *GitDAO) walk(fn func(path models.ProjectPath) error) error {
+	var paths []models.ProjectPath
+	switch {
+	case dao.snapshot != nil:
+		paths = dao.snapshot.paths()
+	case len(dao.layers) == 0:
+		return dao.tree.walk(fn)
+	default:
+		var err error
+		if paths, err = dao.layerPaths(); err != nil {
+			return err
+		}
+	}
+	for _, path := range paths {
+		if err := fn(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// layerPaths returns the paths of the projects of all layers.
+func (dao *GitDAO) layerPaths() ([]models.ProjectPath, error) {
+	seen := map[models.ProjectPath]bool{}
+	paths := []models.ProjectPath{}
+	for _, tree := range dao.trees() {
+		err := tree.walk(func(path models.ProjectPath) error {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	sortPaths(paths)
+	return paths, nil
+}
+
+func (dao *GitDAO) children(path models.ProjectPath) ([]models.ProjectPath, error) {
+	if dao.snapshot != nil {
+		return dao.snapshot.children(path)
+	}
+	if len(dao.layers) == 0 {
+		return dao.tree.children(path)
+	}
+	seen := map[models.ProjectPath]bool{}
+	children := []models.ProjectPath{}
+	found := false
+	for _, tree := range dao.trees() {
+		treeChildren, err := tree.children(path)
+		if err != nil {
+			continue
+		}
+		found = true
+		for _, child := range treeChildren {
+			if !seen[child] {
+				seen[child] = true
+				children = append(children, child)
+			}
+		}
+	}
+	if !found {
+		return nil, models.ErrNotFound
+	}
+	sortPaths(children)
+	return children, nil
+}
+
+// explicitFields reads the values a layer sets for path, without any of the
+// defaults newProject cascades in.
+func (t *metadataTree) explicitFields(path models.ProjectPath) (models.Project, error) {
+	dir, err := t.projectDir(path)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := readMetadata(dir)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "i18n.json")); err == nil {
+		i18n := map[string]interface{}{}
+		if err = json.Unmarshal(data, &i18n); err != nil {
+			return nil, err
+		}
+		fields["i18n"] = i18n
+	}
+	return fields, nil
+}
+
+// recordProvenance notes name as origin of all fields. Nested objects are
+// recorded per dotted field.
+func recordProvenance(fields models.Project, name string, provenance map[string]string) {
+	for key, value := range fields {
+		if nested, ok := value.(map[string]interface{}); ok {
+			for nestedKey := range nested {
+				provenance[key+"."+nestedKey] = name
+			}
+			continue
+		}
+		provenance[key] = name
+	}
+}
+
+// mergeFields sets fields on project. Objects such as i18n are merged per key.
+func mergeFields(project models.Project, fields models.Project) {
+	for key, value := range fields {
+		nested, isMap := value.(map[string]interface{})
+		existing, existingIsMap := project[key].(map[string]interface{})
+		if !isMap || !existingIsMap {
+			project[key] = value
+			continue
+		}
+		merged := map[string]interface{}{}
+		for k, v := range existing {
+			merged[k] = v
+		}
+		for k, v := range nested {
+			merged[k] = v
+		}
+		project[key] = merged
+	}
+}
+
+// resolve builds the project from all layers. The lowest layer having the
+// project resolves it fully, higher layers override the fields they set.
+// Objects such as i18n are merged per key.
+func (dao *GitDAO) resolve(ctx context.Context, path models.ProjectPath) (models.Project, error) {
+	if dao.snapshot != nil {
+		return dao.snapshot.get(path)
+	}
+	if len(dao.layers) == 0 {
+		return dao.tree.newProject(ctx, path)
+	}
+
+	var project models.Project
+	var base *metadataTree
+	provenance := map[string]string{}
+	for i, tree := range dao.trees() {
+		if !tree.isProject(path) {
+			continue
+		}
+		name := dao.layerName(i)
+		if project == nil {
+			resolved, err := tree.newProject(ctx, path)
+			if err != nil {
+				return nil, err
+			}
+			project = resolved
+			base = tree
+			recordProvenance(project, name, provenance)
+			continue
+		}
+
+		fields, err := tree.explicitFields(path)
+		if err != nil {
+			return nil, err
+		}
+		mergeFields(project, fields)
+		recordProvenance(fields, name, provenance)
+		if _, ok := fields["repopath"]; ok {
+			if _, ok := fields["urls"]; !ok {
+				// Computed from the old repopath, compute anew.
+				project["urls"] = base.cascadeURLs(path, project)
+				recordProvenance(models.Project{"urls": project["urls"]}, name, provenance)
+			}
+		}
+	}
+	if project == nil {
+		return nil, models.ErrNotFound
+	}
+	project["provenance"] = provenance
+	return project, nil
+}
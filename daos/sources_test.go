@@ -0,0 +1,84 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSources(t *testing.T) {
+	defer withFixture(map[string]string{
+		"config/i18n_defaults.json":               `{"frameworks/*": {"trunk_kf5": "master", "stable_kf5": "none"}}`,
+		"projects/frameworks/metadata.yaml":       "name: Frameworks\n",
+		"projects/frameworks/solid/metadata.yaml": "repopath: solid\nname: Solid\nrepoactive: true\n",
+	})()
+	for path, content := range map[string]string{
+		"distro/projects/frameworks/solid/metadata.yaml":       "repoactive: false\n",
+		"distro/projects/frameworks/solid/i18n.json":           `{"stable_kf5": "5.38"}`,
+		"distro/projects/frameworks/distro-only/metadata.yaml": "repopath: distro-only\n",
+		"local/projects/frameworks/solid/metadata.yaml":        "name: Solid (patched)\n",
+	} {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte(content), 0644)
+	}
+
+	changed := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	os.Chtimes("local/projects/frameworks/solid/metadata.yaml", changed, changed)
+
+	dao := NewGitDAOInternal(false)
+	dao.AddSource(Source{Name: "distro", Dir: "distro"})
+	dao.AddSource(Source{Name: "local", Dir: "local"})
+	assert.Equal(t, changed, dao.LastModified().UTC())
+
+	project, _, err := dao.Get(context.Background(), "frameworks/solid")
+	assert.NoError(t, err)
+	assert.Equal(t, "Solid (patched)", project["name"])
+	assert.Equal(t, false, project["repoactive"])
+	assert.Equal(t, "solid", project["repopath"])
+	assert.Equal(t, map[string]interface{}{"trunk_kf5": "master", "stable_kf5": "5.38"}, project["i18n"])
+	provenance := project["provenance"].(map[string]string)
+	assert.Equal(t, "local", provenance["name"])
+	assert.Equal(t, "distro", provenance["repoactive"])
+	assert.Equal(t, "repo-metadata", provenance["repopath"])
+	assert.Equal(t, "distro", provenance["i18n.stable_kf5"])
+	assert.Equal(t, "repo-metadata", provenance["i18n.trunk_kf5"])
+
+	project, _, err = dao.Get(context.Background(), "frameworks/distro-only")
+	assert.NoError(t, err)
+	assert.Equal(t, "distro-only", project["repopath"])
+	assert.Equal(t, "distro", project["provenance"].(map[string]string)["repopath"])
+
+	paths, err := dao.Find(context.Background(), "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ProjectPath{"frameworks", "frameworks/distro-only", "frameworks/solid"}, paths)
+
+	children, err := dao.Children(context.Background(), "frameworks")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ProjectPath{"frameworks/distro-only", "frameworks/solid"}, children)
+}
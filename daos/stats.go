@@ -0,0 +1,180 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+)
+
+// Stats of a commit never change, keep some around.
+const maxStatsCache = 64
+
+// computeStats aggregates projects.
+func computeStats(projects map[models.ProjectPath]models.Project) models.Stats {
+	stats := models.Stats{
+		Projects: len(projects),
+		Groups:   map[string]map[string]int{},
+		I18n:     map[string]map[string]int{},
+	}
+	for path, project := range projects {
+		group := toplevel(path)
+		if stats.Groups[group] == nil {
+			stats.Groups[group] = map[string]int{}
+		}
+		projectType, _ := project["type"].(string)
+		stats.Groups[group][projectType]++
+
+		if hasrepo, _ := project["hasrepo"].(bool); hasrepo {
+			stats.HasRepo++
+			if repoactive, _ := project["repoactive"].(bool); repoactive {
+				stats.ActiveRepos++
+			} else {
+				stats.InactiveRepos++
+			}
+		} else {
+			stats.WithoutRepo++
+		}
+
+		i18n, _ := project["i18n"].(map[string]interface{})
+		for key, value := range i18n {
+			if stats.I18n[key] == nil {
+				stats.I18n[key] = map[string]int{}
+			}
+			stats.I18n[key][fmt.Sprint(value)]++
+		}
+
+		if members, _ := project["members"].([]interface{}); len(members) == 0 {
+			stats.WithoutMembers++
+		}
+	}
+	return stats
+}
+
+// commit is a revision of the series.
+type commit struct {
+	sha  string
+	time time.Time
+}
+
+// recentCommits lists up to n commits of repo-metadata, starting at the
+// served revision. The caller holds the repo lock for reading.
+func (dao *GitDAO) recentCommits(ctx context.Context, n int) ([]commit, error) {
+	out, err := dao.git(ctx, dao.tree.dir, "log", "-n", strconv.Itoa(n), "--format=%H %ct", dao.revSHA)
+	if err != nil {
+		return nil, err
+	}
+	commits := []commit{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		seconds, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, commit{fields[0], time.Unix(seconds, 0).UTC()})
+	}
+	return commits, nil
+}
+
+// revisionStats are the stats of a commit of repo-metadata.
+func (dao *GitDAO) revisionStats(ctx context.Context, c commit) (models.Stats, error) {
+	dao.cacheMutex.Lock()
+	cached, ok := dao.statsCache[c.sha]
+	dao.cacheMutex.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	projects, err := dao.resolveRevisionProjects(ctx, c.sha)
+	if err != nil {
+		return models.Stats{}, err
+	}
+	stats := computeStats(projects)
+	stats.Revision = c.sha
+	stats.RevisionTime = c.time
+
+	dao.cacheMutex.Lock()
+	if len(dao.statsCache) >= maxStatsCache {
+		dao.statsCache = map[string]models.Stats{}
+	}
+	dao.statsCache[c.sha] = stats
+	dao.cacheMutex.Unlock()
+	return stats, nil
+}
+
+// servedStats returns the stats of the served projects, computed once per
+// revision, and up to revisions recent commits for the series.
+func (dao *GitDAO) servedStats(ctx context.Context, revisions int) (models.Stats, []commit, error) {
+	dao.rlock(ctx)
+	defer dao.repoMutex.RUnlock()
+
+	dao.cacheMutex.Lock()
+	current := dao.currentStats
+	dao.cacheMutex.Unlock()
+	if current == nil {
+		projects, err := dao.getAll(ctx)
+		if err != nil {
+			return models.Stats{}, nil, err
+		}
+		stats := computeStats(projects)
+		stats.Revision = dao.revSHA
+		stats.RevisionTime = dao.revTime
+		current = &stats
+		dao.cacheMutex.Lock()
+		dao.currentStats = current
+		dao.cacheMutex.Unlock()
+	}
+	if revisions == 0 || dao.snapshot != nil || dao.revSHA == "" {
+		return *current, []commit{}, nil
+	}
+	commits, err := dao.recentCommits(ctx, revisions)
+	return *current, commits, err
+}
+
+// Stats aggregates the served projects and, for the series, the projects of
+// up to revisions recent commits. Like Diff the series is resolved from
+// repo-metadata alone, sources and overrides do not apply to old commits.
+// Without a clone there is no series.
+func (dao *GitDAO) Stats(ctx context.Context, revisions int) (*models.StatsReport, error) {
+	current, commits, err := dao.servedStats(ctx, revisions)
+	if err != nil {
+		return nil, err
+	}
+	report := &models.StatsReport{Current: current, Series: []models.Stats{}}
+	// Commits are exported by SHA, which an update cannot change, so this
+	// runs without holding updates up.
+	for _, c := range commits {
+		stats, err := dao.revisionStats(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		report.Series = append(report.Series, stats)
+	}
+	return report, nil
+}
@@ -0,0 +1,73 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	defer withFixture(map[string]string{
+		"config/i18n_defaults.json":                  `{"frameworks/*": {"trunk_kf5": "master"}}`,
+		"projects/frameworks/metadata.yaml":          "type: component\nhasrepo: false\n",
+		"projects/frameworks/solid/metadata.yaml":    "type: project\nrepopath: solid\nhasrepo: true\nrepoactive: true\n",
+		"projects/frameworks/kirigami/metadata.yaml": "type: project\nrepopath: kirigami\nhasrepo: true\nrepoactive: true\n",
+		"projects/playground/old/metadata.yaml":      "type: project\nrepopath: old\nhasrepo: true\nrepoactive: false\n",
+	})()
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "one")
+	ioutil.WriteFile("repo-metadata/projects/playground/old/metadata.yaml",
+		[]byte("type: project\nrepopath: old\nhasrepo: true\nrepoactive: true\n"), 0644)
+	git("commit", "-q", "-a", "-m", "two")
+
+	dao := NewGitDAOInternal(false)
+	report, err := dao.Stats(context.Background(), 5)
+	assert.NoError(t, err)
+	current := report.Current
+	assert.Equal(t, dao.Revision(), current.Revision)
+	assert.Equal(t, dao.RevisionTime(), current.RevisionTime)
+	assert.Equal(t, 4, current.Projects)
+	assert.Equal(t, map[string]map[string]int{
+		"frameworks": {"component": 1, "project": 2},
+		"playground": {"project": 1},
+	}, current.Groups)
+	assert.Equal(t, 3, current.HasRepo)
+	assert.Equal(t, 1, current.WithoutRepo)
+	assert.Equal(t, 3, current.ActiveRepos)
+	assert.Equal(t, 0, current.InactiveRepos)
+	assert.Equal(t, 2, current.I18n["trunk_kf5"]["master"])
+	assert.Equal(t, 4, current.WithoutMembers)
+
+	if assert.Equal(t, 2, len(report.Series), "only two commits") {
+		assert.Equal(t, current, report.Series[0])
+		assert.Equal(t, 2, report.Series[1].ActiveRepos)
+		assert.Equal(t, 1, report.Series[1].InactiveRepos)
+	}
+
+	report, err = dao.Stats(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Series)
+}
@@ -0,0 +1,267 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store persists the resolved projects of the last good revision so a
+// restarted server can serve them before it got to look at git.
+//
+// There is a bucket per revision in the revisions bucket, holding the JSON
+// of every project by path. The meta bucket notes which revision is the
+// latest and when it was committed.
+type Store struct {
+	db *bolt.DB
+}
+
+var (
+	metaBucket      = []byte("meta")
+	revisionsBucket = []byte("revisions")
+	revisionKey     = []byte("revision")
+	revisionTimeKey = []byte("revision_time")
+)
+
+// snapshot is what a Store holds of a revision. Projects are kept encoded,
+// decoding hands out a fresh copy every time.
+type snapshot struct {
+	revision string
+	revTime  time.Time
+	projects map[models.ProjectPath][]byte
+}
+
+// OpenStore opens or creates the store in file. Only one process may have it
+// open at a time.
+func OpenStore(file string) (*Store, error) {
+	db, err := bolt.Open(file, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// save replaces the stored revision with snap.
+func (s *Store) save(snap *snapshot) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		revisions, err := tx.CreateBucketIfNotExists(revisionsBucket)
+		if err != nil {
+			return err
+		}
+		if revisions.Bucket([]byte(snap.revision)) != nil {
+			if err = revisions.DeleteBucket([]byte(snap.revision)); err != nil {
+				return err
+			}
+		}
+		bucket, err := revisions.CreateBucket([]byte(snap.revision))
+		if err != nil {
+			return err
+		}
+		for path, data := range snap.projects {
+			if err = bucket.Put([]byte(path), data); err != nil {
+				return err
+			}
+		}
+
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		if err = meta.Put(revisionKey, []byte(snap.revision)); err != nil {
+			return err
+		}
+		revTime, err := snap.revTime.MarshalText()
+		if err != nil {
+			return err
+		}
+		if err = meta.Put(revisionTimeKey, revTime); err != nil {
+			return err
+		}
+
+		// Older revisions are of no use anymore.
+		var stale [][]byte
+		err = revisions.ForEach(func(name []byte, _ []byte) error {
+			if string(name) != snap.revision {
+				stale = append(stale, append([]byte{}, name...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, name := range stale {
+			if err = revisions.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// load returns the latest stored revision, nil when there is none.
+func (s *Store) load() (*snapshot, error) {
+	var snap *snapshot
+	err := s.db.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		revisions := tx.Bucket(revisionsBucket)
+		if meta == nil || revisions == nil {
+			return nil
+		}
+		revision := string(meta.Get(revisionKey))
+		bucket := revisions.Bucket([]byte(revision))
+		if bucket == nil {
+			return nil
+		}
+		snap = &snapshot{revision: revision, projects: map[models.ProjectPath][]byte{}}
+		if err := snap.revTime.UnmarshalText(meta.Get(revisionTimeKey)); err != nil {
+			return err
+		}
+		return bucket.ForEach(func(path []byte, data []byte) error {
+			// Values are only valid during the transaction.
+			snap.projects[models.ProjectPath(path)] = append([]byte{}, data...)
+			return nil
+		})
+	})
+	return snap, err
+}
+
+func (snap *snapshot) get(path models.ProjectPath) (models.Project, error) {
+	data, ok := snap.projects[path]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	project := models.Project{}
+	if err := json.Unmarshal(data, &project); err != nil {
+		return nil, err
+	}
+	// Overrides add to the provenance as resolve made it.
+	if provenance, ok := project["provenance"].(map[string]interface{}); ok {
+		fields := map[string]string{}
+		for field, layer := range provenance {
+			fields[field], _ = layer.(string)
+		}
+		project["provenance"] = fields
+	}
+	return project, nil
+}
+
+func (snap *snapshot) paths() []models.ProjectPath {
+	paths := make([]models.ProjectPath, 0, len(snap.projects))
+	for path := range snap.projects {
+		paths = append(paths, path)
+	}
+	sortPaths(paths)
+	return paths
+}
+
+func (snap *snapshot) children(path models.ProjectPath) ([]models.ProjectPath, error) {
+	children := []models.ProjectPath{}
+	found := false
+	for _, candidate := range snap.paths() {
+		if !strings.HasPrefix(candidate.String(), path.String()+"/") {
+			continue
+		}
+		found = true
+		if parent, _ := candidate.Parent(); parent == path {
+			children = append(children, candidate)
+		}
+	}
+	if _, ok := snap.projects[path]; !ok && !found {
+		return nil, models.ErrNotFound
+	}
+	return children, nil
+}
+
+// SetStore makes the DAO persist the resolved projects after every update
+// to a new revision. Unless the clone is at another revision already, the
+// stored projects are served right away until an update reconciles with
+// git.
+func (dao *GitDAO) SetStore(ctx context.Context, store *Store) error {
+	snap, err := store.load()
+	if err != nil {
+		return err
+	}
+
+	dao.updateMutex.Lock()
+	defer dao.updateMutex.Unlock()
+	dao.repoMutex.Lock()
+	defer dao.repoMutex.Unlock()
+	dao.store = store
+	if snap == nil {
+		return nil
+	}
+	dao.savedRevision = snap.revision
+	if dao.revSHA != "" && dao.revSHA != snap.revision {
+		return nil // The next update stores the clone's revision.
+	}
+	dao.log(ctx).Info("serving stored revision", "revision", snap.revision, "projects", len(snap.projects))
+	dao.snapshot = snap
+	dao.revSHA = snap.revision
+	dao.revTime = snap.revTime
+	dao.resetCache(ctx)
+	return nil
+}
+
+// persist stores the projects of the served revision unless they are
+// stored already. With layers the revision does not tell whether anything
+// changed, they are stored every time. The caller holds updateMutex.
+func (dao *GitDAO) persist(ctx context.Context) {
+	dao.repoMutex.RLock()
+	defer dao.repoMutex.RUnlock()
+	if dao.store == nil || dao.snapshot != nil || dao.revSHA == "" {
+		return
+	}
+	if dao.revSHA == dao.savedRevision && len(dao.layers) == 0 {
+		return
+	}
+
+	start := time.Now()
+	snap := &snapshot{revision: dao.revSHA, revTime: dao.revTime, projects: map[models.ProjectPath][]byte{}}
+	err := dao.walk(func(path models.ProjectPath) error {
+		project, err := dao.resolve(ctx, path)
+		if err != nil {
+			return err
+		}
+		snap.projects[path], err = json.Marshal(project)
+		return err
+	})
+	if err == nil {
+		err = dao.store.save(snap)
+	}
+	if err != nil {
+		dao.log(ctx).Error("failed to store revision", "revision", snap.revision, "error", err)
+		return
+	}
+	dao.savedRevision = snap.revision
+	dao.log(ctx).Info("stored revision", "revision", snap.revision,
+		"projects", len(snap.projects), "duration", time.Since(start))
+}
@@ -0,0 +1,122 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withUpstream turns the fixture into a clone of a local upstream repository
+// so updates need no network.
+func withUpstream(files map[string]string) func() {
+	cleanup := withFixture(files)
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "one")
+	os.Rename("repo-metadata", "upstream")
+	if out, err := exec.Command("git", "clone", "-q", "upstream", "repo-metadata").CombinedOutput(); err != nil {
+		panic(string(out))
+	}
+	return cleanup
+}
+
+func TestStore(t *testing.T) {
+	defer withUpstream(map[string]string{
+		"projects/frameworks/solid/metadata.yaml": "repopath: solid\nname: Solid\n",
+		"projects/calligra/krita/metadata.yaml":   "repopath: krita\nname: Krita\n",
+	})()
+	ctx := context.Background()
+
+	store, err := OpenStore("store.db")
+	assert.NoError(t, err)
+	dao := NewGitDAOInternal(false)
+	assert.NoError(t, dao.SetStore(ctx, store))
+	_, err = dao.UpdateClone(ctx)
+	assert.NoError(t, err)
+	revision := dao.Revision()
+	assert.NotEmpty(t, revision)
+	snap, err := store.load()
+	assert.NoError(t, err)
+	assert.Equal(t, revision, snap.revision)
+	assert.Len(t, snap.projects, 2)
+	assert.NoError(t, store.Close())
+
+	// Without a clone the stored revision is served.
+	os.RemoveAll("repo-metadata")
+	store, err = OpenStore("store.db")
+	assert.NoError(t, err)
+	defer store.Close()
+	dao = NewGitDAOInternal(false)
+	assert.NoError(t, dao.SetStore(ctx, store))
+	assert.Equal(t, revision, dao.Revision())
+	project, _, err := dao.Get(ctx, "frameworks/solid")
+	assert.NoError(t, err)
+	assert.Equal(t, "Solid", project["name"])
+	_, _, err = dao.Get(ctx, "frameworks/nope")
+	assert.Equal(t, models.ErrNotFound, err)
+	paths, err := dao.Find(ctx, "", "krita")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ProjectPath{"calligra/krita"}, paths)
+	children, err := dao.Children(ctx, "frameworks")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ProjectPath{"frameworks/solid"}, children)
+
+	// Once there is a clone again it takes over and gets stored.
+	os.Rename("upstream", "repo-metadata")
+	os.MkdirAll("repo-metadata/projects/frameworks/kirigami", 0755)
+	ioutil.WriteFile("repo-metadata/projects/frameworks/kirigami/metadata.yaml", []byte("repopath: kirigami\n"), 0644)
+	git("add", ".")
+	git("commit", "-q", "-m", "two")
+	os.Rename("repo-metadata", "upstream")
+	exec.Command("git", "clone", "-q", "upstream", "repo-metadata").Run()
+	_, err = dao.UpdateClone(ctx)
+	assert.NoError(t, err)
+	assert.NotEqual(t, revision, dao.Revision())
+	_, _, err = dao.Get(ctx, "frameworks/kirigami")
+	assert.NoError(t, err)
+	snap, err = store.load()
+	assert.NoError(t, err)
+	assert.Equal(t, dao.Revision(), snap.revision)
+	assert.Len(t, snap.projects, 3)
+}
+
+func TestUpdateCloneFailure(t *testing.T) {
+	defer withUpstream(map[string]string{
+		"projects/frameworks/solid/metadata.yaml": "repopath: solid\n",
+	})()
+	os.RemoveAll("upstream")
+
+	dao := NewGitDAOInternal(false)
+	revision := dao.Revision()
+	_, err := dao.UpdateClone(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, revision, dao.Revision())
+	_, _, err = dao.Get(context.Background(), "frameworks/solid")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,92 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TokenDAO holds the API tokens. They are read from a yaml file, or from all
+// yaml files in a directory. Each file is a list of tokens with name, hash
+// (the hex encoded SHA-256 of the secret) and scopes.
+type TokenDAO struct {
+	tokens map[string]models.Token
+}
+
+func NewTokenDAO(path string) (*TokenDAO, error) {
+	dao := &TokenDAO{map[string]models.Token{}}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(path, "*.yaml"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range files {
+		if err = dao.load(file); err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+	}
+	return dao, nil
+}
+
+func (dao *TokenDAO) load(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var tokens []models.Token
+	if err = yaml.Unmarshal(data, &tokens); err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		hash := strings.ToLower(token.Hash)
+		if len(hash) != 64 {
+			return fmt.Errorf("token %s: hash is not a hex encoded SHA-256", token.Name)
+		}
+		if _, ok := dao.tokens[hash]; ok {
+			return fmt.Errorf("token %s: hash already in use", token.Name)
+		}
+		dao.tokens[hash] = token
+	}
+	return nil
+}
+
+// Token returns the token whose secret hashes to hash.
+func (dao *TokenDAO) Token(hash string) (models.Token, error) {
+	token, ok := dao.tokens[hash]
+	if !ok {
+		return models.Token{}, models.ErrInvalidToken
+	}
+	return token, nil
+}
@@ -0,0 +1,65 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokens(t *testing.T) {
+	defer withFixture(map[string]string{})()
+	os.Mkdir("tokens", 0755)
+	ioutil.WriteFile(filepath.Join("tokens", "ci.yaml"), []byte(
+		"- name: ci\n  hash: "+models.HashToken("ci-secret")+"\n  scopes: [poll]\n"), 0644)
+	ioutil.WriteFile(filepath.Join("tokens", "admins.yaml"), []byte(
+		"- name: admin\n  hash: "+models.HashToken("admin-secret")+"\n  scopes: [admin]\n"), 0644)
+	ioutil.WriteFile(filepath.Join("tokens", "README"), []byte("not a token file"), 0644)
+
+	dao, err := NewTokenDAO("tokens")
+	assert.NoError(t, err)
+	token, err := dao.Token(models.HashToken("ci-secret"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ci", token.Name)
+	assert.True(t, token.HasScope(models.ScopePoll))
+	assert.False(t, token.HasScope(models.ScopeRead))
+	token, err = dao.Token(models.HashToken("admin-secret"))
+	assert.NoError(t, err)
+	assert.True(t, token.HasScope(models.ScopePoll))
+	_, err = dao.Token("ci-secret")
+	assert.Equal(t, models.ErrInvalidToken, err)
+
+	// A single file works too.
+	dao, err = NewTokenDAO(filepath.Join("tokens", "ci.yaml"))
+	assert.NoError(t, err)
+	_, err = dao.Token(models.HashToken("admin-secret"))
+	assert.Equal(t, models.ErrInvalidToken, err)
+
+	ioutil.WriteFile("plain.yaml", []byte("- name: oops\n  hash: ci-secret\n"), 0644)
+	_, err = NewTokenDAO("plain.yaml")
+	assert.Error(t, err)
+}
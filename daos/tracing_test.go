@@ -0,0 +1,101 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func recordSpans() (*tracetest.SpanRecorder, func()) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder, func() { otel.SetTracerProvider(noop.NewTracerProvider()) }
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestGetSpans(t *testing.T) {
+	defer withFixture(map[string]string{
+		"projects/frameworks/solid/metadata.yaml": "repopath: solid\n",
+	})()
+	recorder, restore := recordSpans()
+	defer restore()
+
+	dao := NewGitDAOInternal(false)
+	ctx := context.Background()
+	dao.Get(ctx, "frameworks/solid")
+	dao.Get(ctx, "frameworks/solid")
+	dao.Find(ctx, "solid", "")
+
+	names := []string{}
+	gets := []map[attribute.Key]attribute.Value{}
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+		if span.Name() == "GitDAO.Get" {
+			gets = append(gets, spanAttributes(span))
+		}
+	}
+	assert.Contains(t, names, "newProject")
+	assert.Contains(t, names, "GitDAO.Find")
+	assert.Len(t, gets, 2)
+	assert.Equal(t, "frameworks/solid", gets[0]["project.path"].AsString())
+	assert.False(t, gets[0]["cache.hit"].AsBool())
+	assert.True(t, gets[1]["cache.hit"].AsBool())
+	assert.Contains(t, gets[0], attribute.Key("lock.wait_ms"))
+
+	// newProject is a child of the Get missing the cache.
+	for _, span := range recorder.Ended() {
+		if span.Name() == "newProject" {
+			assert.True(t, span.Parent().IsValid())
+		}
+	}
+}
+
+func TestGitSpans(t *testing.T) {
+	defer withFixture(map[string]string{})()
+	recorder, restore := recordSpans()
+	defer restore()
+
+	dao := NewGitDAOInternal(false)
+	dao.revParse(context.Background())
+
+	spans := recorder.Ended()
+	assert.NotEmpty(t, spans)
+	span := spans[len(spans)-1]
+	assert.Equal(t, "git rev-parse", span.Name())
+	assert.Equal(t, "repo-metadata", spanAttributes(span)["git.dir"].AsString())
+	// Not a repository.
+	assert.Len(t, span.Events(), 1)
+}
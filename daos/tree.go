@@ -0,0 +1,218 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+	"anongit.kde.org/websites/api-projects-kde-org.git/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v2"
+)
+
+// metadataTree resolves projects from a checkout of repo-metadata in dir.
+// It does no caching and no locking, that is up to the owner.
+type metadataTree struct {
+	dir          string
+	urlTemplates URLTemplates
+}
+
+func (t *metadataTree) projectsDir() string {
+	return filepath.Join(t.dir, "projects")
+}
+
+func convert(i interface{}) interface{} {
+	switch x := i.(type) {
+	case map[interface{}]interface{}:
+		m2 := map[string]interface{}{}
+		for k, v := range x {
+			m2[k.(string)] = convert(v)
+		}
+		return m2
+	case []interface{}:
+		for i, v := range x {
+			x[i] = convert(v)
+		}
+	}
+	return i
+}
+
+// projectDir returns the directory of path on disk. Symlinks are resolved
+// and must not lead out of the projects directory.
+func (t *metadataTree) projectDir(path models.ProjectPath) (string, error) {
+	root, err := filepath.EvalSymlinks(t.projectsDir())
+	if err != nil {
+		return "", err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Join(t.projectsDir(), filepath.FromSlash(path.String())))
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		return "", models.ErrInvalidPath
+	}
+	return dir, nil
+}
+
+func (t *metadataTree) isProject(path models.ProjectPath) bool {
+	dir, err := t.projectDir(path)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(dir, "metadata.yaml"))
+	return err == nil
+}
+
+// readMetadata reads the metadata.yaml in dir as JSON compatible object.
+func readMetadata(dir string) (models.Project, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "metadata.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	var body interface{}
+	if err = yaml.Unmarshal([]byte(data), &body); err != nil {
+		return nil, err
+	}
+	jsonData, err := json.Marshal(convert(body))
+	if err != nil {
+		return nil, err
+	}
+	jsonObj := models.Project{}
+	err = json.Unmarshal([]byte(jsonData), &jsonObj)
+	return jsonObj, err
+}
+
+// walk calls fn for every project in the tree.
+func (t *metadataTree) walk(fn func(path models.ProjectPath) error) error {
+	projectsDir := t.projectsDir()
+	return filepath.Walk(projectsDir, func(dir string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || dir == projectsDir {
+			return nil
+		}
+		rel, err := filepath.Rel(projectsDir, dir)
+		if err != nil {
+			return err
+		}
+		path, err := models.ParseProjectPath(filepath.ToSlash(rel))
+		if err != nil || !t.isProject(path) {
+			return nil
+		}
+		return fn(path)
+	})
+}
+
+func (t *metadataTree) children(path models.ProjectPath) ([]models.ProjectPath, error) {
+	dir, err := t.projectDir(path)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	children := []models.ProjectPath{}
+	for _, info := range infos {
+		child, err := path.Child(info.Name())
+		if err != nil {
+			continue
+		}
+		if info.IsDir() && t.isProject(child) {
+			children = append(children, child)
+		}
+	}
+	return children, nil
+}
+
+func (t *metadataTree) i18nDefaults() (*globCascade, error) {
+	i18nFile, err := os.Open(filepath.Join(t.dir, "config/i18n_defaults.json"))
+	if err != nil {
+		return &globCascade{}, err
+	}
+	defer i18nFile.Close()
+	// NOTE: Documentation of repo-metadata says the entires in the json must
+	// be ordered, the first matching pattern wins.
+	rules, err := decodeGlobRules(i18nFile)
+	return &globCascade{rules: rules}, err
+}
+
+func (t *metadataTree) newProject(ctx context.Context, path models.ProjectPath) (models.Project, error) {
+	_, span := tracing.Tracer().Start(ctx, "newProject", trace.WithAttributes(
+		attribute.String("project.path", path.String()),
+		attribute.String("tree.dir", t.dir)))
+	defer span.End()
+
+	dir, err := t.projectDir(path)
+	if os.IsNotExist(err) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Patch i18n in, it's a separate file but why that is nobody knows.
+	// Put it in an i18n property on the return object.
+	jsonObj, err := readMetadata(dir)
+	if os.IsNotExist(err) {
+		return nil, models.ErrNotFound // A directory grouping projects.
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// TODO: cache
+	i18nJSONObj := map[string]interface{}{}
+	// First use default values
+	i18nDefaults, _ := t.i18nDefaults()
+	if values, ok := i18nDefaults.match(path); ok {
+		if defaults, ok := values.(map[string]interface{}); ok {
+			i18nJSONObj = defaults
+		}
+	}
+
+	// Then patch sepcific project data in if available. This cascades the
+	// attributes, e.g. if there's x and y in the defaults, the specific data may
+	// specify only y to override y but leave x at the default.
+	i18nFile, err := os.Open(filepath.Join(dir, "i18n.json"))
+	if err == nil { // Components and the like have no i18n data.
+		var i18nOverridesJSONObj map[string]interface{}
+		if err = json.NewDecoder(i18nFile).Decode(&i18nOverridesJSONObj); err != nil {
+			panic(err)
+		}
+		for k, v := range i18nOverridesJSONObj {
+			i18nJSONObj[k] = v
+		}
+	}
+
+	jsonObj["i18n"] = i18nJSONObj
+	jsonObj["urls"] = t.cascadeURLs(path, jsonObj)
+
+	return jsonObj, nil
+}
@@ -0,0 +1,143 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package daos
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+	"gopkg.in/yaml.v2"
+)
+
+// URLTemplates are the templates of the computed urls of a project.
+// Templates may use {repopath}, {projectpath} and {name} placeholders.
+// Keys are the keys in the urls object of a project, e.g. "clone".
+type URLTemplates map[string]string
+
+// DefaultURLTemplates are used unless configured otherwise.
+var DefaultURLTemplates = URLTemplates{
+	"clone":   "https://anongit.kde.org/{repopath}.git",
+	"push":    "git@git.kde.org:{repopath}.git",
+	"browse":  "https://cgit.kde.org/{repopath}.git",
+	"bugs":    "https://bugs.kde.org/enter_bug.cgi?product={repopath}",
+	"apidocs": "https://api.kde.org/{projectpath}/html/index.html",
+}
+
+// Legacy metadata keys and the urls key they set.
+var legacyURLKeys = map[string]string{
+	"urls_gitrepo":   "clone",
+	"urls_webaccess": "browse",
+}
+
+// SetURLTemplates replaces the configured templates. Templates missing from
+// templates keep their default.
+func (dao *GitDAO) SetURLTemplates(templates URLTemplates) {
+	dao.repoMutex.Lock()
+	defer dao.repoMutex.Unlock()
+
+	dao.tree.urlTemplates = URLTemplates{}
+	for key, template := range DefaultURLTemplates {
+		dao.tree.urlTemplates[key] = template
+	}
+	for key, template := range templates {
+		dao.tree.urlTemplates[key] = template
+	}
+	for _, layer := range dao.layers {
+		layer.tree.urlTemplates = dao.tree.urlTemplates
+	}
+	dao.resetCache(context.Background())
+}
+
+// explicitURLs returns the url values set in the metadata of path. They may
+// be set in a urls object or through the legacy urls_* keys.
+func (t *metadataTree) explicitURLs(path models.ProjectPath) map[string]string {
+	urls := map[string]string{}
+	dir, err := t.projectDir(path)
+	if err != nil {
+		return urls
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "metadata.yaml"))
+	if err != nil {
+		return urls // Intermediate directories need not be projects.
+	}
+	var body map[string]interface{}
+	if err = yaml.Unmarshal(data, &body); err != nil {
+		return urls
+	}
+	for legacy, key := range legacyURLKeys {
+		if value, ok := body[legacy].(string); ok && value != "" {
+			urls[key] = value
+		}
+	}
+	if object, ok := body["urls"].(map[interface{}]interface{}); ok {
+		for key, value := range object {
+			if str, ok := value.(string); ok && str != "" {
+				urls[key.(string)] = str
+			}
+		}
+	}
+	return urls
+}
+
+// placeholder matches the placeholders of url templates.
+var placeholder = regexp.MustCompile(`\{[a-z]+\}`)
+
+// cascadeURLs computes the urls of a project. Values set in the metadata of
+// the project win over values set by its parents, which win over the
+// configured templates. All of them are expanded as templates, so a parent
+// may set e.g. a clone template for all projects below it. Literal values
+// of a parent are its own urls and do not cascade.
+func (t *metadataTree) cascadeURLs(path models.ProjectPath, project models.Project) map[string]interface{} {
+	templates := map[string]string{}
+	for key, template := range t.urlTemplates {
+		templates[key] = template
+	}
+	// From the top most parent down to the project itself.
+	ancestors := []models.ProjectPath{path}
+	for parent, ok := path.Parent(); ok; parent, ok = parent.Parent() {
+		ancestors = append([]models.ProjectPath{parent}, ancestors...)
+	}
+	for _, ancestor := range ancestors {
+		for key, template := range t.explicitURLs(ancestor) {
+			if ancestor == path || placeholder.MatchString(template) {
+				templates[key] = template
+			}
+		}
+	}
+
+	repopath, _ := project["repopath"].(string)
+	replacer := strings.NewReplacer(
+		"{repopath}", repopath,
+		"{projectpath}", path.String(),
+		"{name}", path.Name())
+	urls := map[string]interface{}{}
+	for key, template := range templates {
+		if repopath == "" && strings.Contains(template, "{repopath}") {
+			continue // Without repo there is nothing to point at.
+		}
+		urls[key] = replacer.Replace(template)
+	}
+	return urls
+}
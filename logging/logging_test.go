@@ -0,0 +1,63 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "json", "info")
+	assert.NoError(t, err)
+	logger.Debug("dropped")
+	logger.Info("kept", "path", "frameworks/solid")
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "kept", record["msg"])
+	assert.Equal(t, "frameworks/solid", record["path"])
+
+	buf.Reset()
+	logger, err = New(&buf, "logfmt", "debug")
+	assert.NoError(t, err)
+	logger.Debug("kept")
+	assert.Contains(t, buf.String(), "level=DEBUG msg=kept")
+
+	_, err = New(&buf, "xml", "info")
+	assert.Error(t, err)
+	_, err = New(&buf, "json", "loud")
+	assert.Error(t, err)
+}
+
+func TestContext(t *testing.T) {
+	fallback := slog.Default()
+	assert.Equal(t, fallback, FromContext(context.Background(), fallback))
+
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	ctx := WithLogger(context.Background(), logger)
+	assert.Equal(t, logger, FromContext(ctx, fallback))
+}
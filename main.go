@@ -21,58 +21,53 @@
 package main
 
 import (
-	"flag"
 	"fmt"
-	"net/http"
+	"io"
+	"os"
+	"strings"
+)
 
-	"anongit.kde.org/websites/api-projects-kde-org.git/apis"
-	"anongit.kde.org/websites/api-projects-kde-org.git/daos"
-	"anongit.kde.org/websites/api-projects-kde-org.git/services"
+const usage = `Usage: %s [command] [flags]
 
-	"github.com/coreos/go-systemd/activation"
-	"github.com/gin-gonic/gin"
-)
+Commands:
+  serve    serve the API (default)
+  get      print the project at a path
+  find     print the paths of projects matching --id and --repopath
+  update   clone or update the repo-metadata checkout
+  dump     print all projects
 
-func main() {
-	flag.Parse()
+Run a command with -h for its flags.
+`
 
-	fmt.Println("Ready to rumble...")
-	router := gin.Default()
-	router.GET("/", func(c *gin.Context) {
-		c.Redirect(http.StatusMovedPermanently, "/doc")
-	})
-	router.StaticFS("/doc", http.Dir("contents-doc"))
+var commands = map[string]func(args []string, stdout io.Writer) error{
+	"get":    get,
+	"find":   find,
+	"dump":   dump,
+	"update": update,
+}
 
-	v1 := router.Group("/v1")
-	{
-		gitDAO := daos.NewGitDAO()
-		apis.ServeGitResource(v1, services.NewGitService(gitDAO))
-		apis.ServeProjectResource(v1, services.NewProjectService(gitDAO))
-	}
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
 
-	listeners, err := activation.Listeners(true)
-	if err != nil {
-		panic(err)
+func main() {
+	command := "serve"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
 
-	// if len(listeners) != 1 {
-	// 	gracehttp.Serve()
-	// } else {
-	// grace is the only thing that seems to properly support multiple sockets,
-	// but unfortunately it cannot tell itself apart from
-	// user-systemds nor systemd-active making it shitty to deploy and shitty to
-	// test as former needs root access and latter requires testing through
-	// the actual systemd PID 1.
-	fmt.Println("starting servers")
-	var servers []*http.Server
-	for _, listener := range listeners {
-		server := &http.Server{Handler: router}
-		go server.Serve(listener)
-		servers = append(servers, server)
+	if command == "serve" {
+		serve(args)
+		return
+	}
+	run, ok := commands[command]
+	if !ok {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		os.Exit(2)
+	}
+	if err := run(args, os.Stdout); err != nil {
+		fatal(err)
 	}
-	select {}
-	// fmt.Println("starting grace")
-	// gracehttp.SetLogger(log.New(os.Stderr, "logger: ", log.Lshortfile))
-	// 	gracehttp.Serve(servers...)
-	// }
 }
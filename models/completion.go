@@ -0,0 +1,32 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package models
+
+// Completion is a project matching a typeahead query.
+type Completion struct {
+	Path     ProjectPath `json:"path"`
+	Name     string      `json:"name"`
+	Repopath string      `json:"repopath,omitempty"`
+	// Field that matched best, one of path, name or repopath.
+	Field string `json:"field"`
+	// How it matched, one of prefix, substring or fuzzy.
+	Match string `json:"match"`
+}
@@ -0,0 +1,52 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package models
+
+// Diff describes how the resolved projects changed between two revisions.
+type Diff struct {
+	From     string                        `json:"from"`
+	To       string                        `json:"to"`
+	Added    []ProjectPath                 `json:"added"`
+	Removed  []ProjectPath                 `json:"removed"`
+	Moved    []Move                        `json:"moved"`
+	Modified map[ProjectPath][]FieldChange `json:"modified"`
+}
+
+// Changes counts the projects that were added, removed, moved or modified.
+func (d *Diff) Changes() int {
+	return len(d.Added) + len(d.Removed) + len(d.Moved) + len(d.Modified)
+}
+
+// Move is a project whose repopath stayed the same but whose path changed.
+type Move struct {
+	From     ProjectPath `json:"from"`
+	To       ProjectPath `json:"to"`
+	Repopath string      `json:"repopath"`
+}
+
+// FieldChange is a changed value of a project. Nested values are flattened
+// into dotted fields, e.g. i18n.trunk_kf5. Old or New are nil when the field
+// was added or removed.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
@@ -0,0 +1,66 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrNotFound is returned when no project matches a path or repopath.
+var ErrNotFound = errors.New("project not found")
+
+// ErrUnknownBranchGroup is returned for branch groups without data.
+var ErrUnknownBranchGroup = errors.New("unknown branch group")
+
+// ErrUnknownRevision is returned for revisions not in the repository.
+var ErrUnknownRevision = errors.New("unknown revision")
+
+// ErrRevisionOutOfRange is returned for revisions too far from the one
+// compared to.
+var ErrRevisionOutOfRange = errors.New("revision out of range")
+
+// ErrBranchGroupsUnavailable is returned when kde-build-metadata has no
+// logical-module-structure (yet).
+var ErrBranchGroupsUnavailable = errors.New("branch groups unavailable")
+
+// ErrNoBranch is returned when a branch group has no branch for a project.
+var ErrNoBranch = errors.New("no branch in branch group")
+
+// ErrInvalidToken is returned for API tokens that are not known.
+var ErrInvalidToken = errors.New("invalid token")
+
+// ErrUnknownJob is returned for poll jobs that do not exist (anymore).
+var ErrUnknownJob = errors.New("unknown job")
+
+// CycleError is returned when dependencies form a cycle. Cycle lists the
+// projects of the cycle, starting and ending with the same project.
+type CycleError struct {
+	Cycle []ProjectPath
+}
+
+func (e *CycleError) Error() string {
+	parts := make([]string, len(e.Cycle))
+	for i, path := range e.Cycle {
+		parts[i] = path.String()
+	}
+	return "dependency cycle: " + strings.Join(parts, " -> ")
+}
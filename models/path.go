@@ -0,0 +1,92 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package models
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ProjectPath is the canonical path of a project relative to the projects
+// directory of repo-metadata, e.g. "frameworks/solid". It never has leading
+// or trailing slashes and never leaves the projects directory. Construct it
+// through ParseProjectPath.
+type ProjectPath string
+
+// ErrInvalidPath is returned for paths that cannot name a project.
+var ErrInvalidPath = errors.New("invalid project path")
+
+// ParseProjectPath validates and normalizes str. Leading, trailing and
+// repeated slashes are dropped. Traversal, including percent encoded
+// traversal, NUL bytes and backslashes are rejected rather than cleaned so
+// a bogus path never silently maps onto another project.
+func ParseProjectPath(str string) (ProjectPath, error) {
+	if strings.ContainsAny(str, "\x00\\") {
+		return "", ErrInvalidPath
+	}
+	// Paths arrive decoded already. Anything still encoded is either double
+	// encoded or garbage, neither names a project.
+	if unescaped, err := url.PathUnescape(str); err != nil || unescaped != str {
+		return "", ErrInvalidPath
+	}
+
+	segments := []string{}
+	for _, segment := range strings.Split(str, "/") {
+		switch segment {
+		case "":
+			continue
+		case ".", "..":
+			return "", ErrInvalidPath
+		}
+		segments = append(segments, segment)
+	}
+	if len(segments) == 0 {
+		return "", ErrInvalidPath
+	}
+	return ProjectPath(strings.Join(segments, "/")), nil
+}
+
+func (p ProjectPath) String() string {
+	return string(p)
+}
+
+// Name is the last element of the path, e.g. "solid". This is what Find
+// calls the id.
+func (p ProjectPath) Name() string {
+	return path.Base(string(p))
+}
+
+// Parent returns the path of the directory containing p. ok is false for top
+// level paths.
+func (p ProjectPath) Parent() (parent ProjectPath, ok bool) {
+	dir := path.Dir(string(p))
+	if dir == "." {
+		return "", false
+	}
+	return ProjectPath(dir), true
+}
+
+// Child returns the path of the entry name below p.
+func (p ProjectPath) Child(name string) (ProjectPath, error) {
+	return ParseProjectPath(string(p) + "/" + name)
+}
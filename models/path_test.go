@@ -0,0 +1,98 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProjectPath(t *testing.T) {
+	valid := map[string]ProjectPath{
+		"frameworks/solid":     "frameworks/solid",
+		"/frameworks/solid":    "frameworks/solid",
+		"//frameworks//solid/": "frameworks/solid",
+		"calligra":             "calligra",
+		"a..b/c":               "a..b/c",
+	}
+	for input, expected := range valid {
+		path, err := ParseProjectPath(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, path, input)
+	}
+
+	invalid := []string{
+		"",
+		"/",
+		"..",
+		"/../etc/passwd",
+		"frameworks/../../etc",
+		"frameworks/./solid",
+		"%2e%2e/etc",
+		"frameworks%2fsolid",
+		"foo\x00bar",
+		"..\\..\\etc",
+		"%zz",
+	}
+	for _, input := range invalid {
+		_, err := ParseProjectPath(input)
+		assert.Equal(t, ErrInvalidPath, err, input)
+	}
+}
+
+func TestProjectPathParent(t *testing.T) {
+	parent, ok := ProjectPath("frameworks/solid").Parent()
+	assert.True(t, ok)
+	assert.Equal(t, ProjectPath("frameworks"), parent)
+
+	_, ok = ProjectPath("frameworks").Parent()
+	assert.False(t, ok)
+
+	assert.Equal(t, "solid", ProjectPath("frameworks/solid").Name())
+}
+
+func FuzzParseProjectPath(f *testing.F) {
+	for _, seed := range []string{"frameworks/solid", "/a//b/", "../x", "%2e%2e", "a\x00b"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		path, err := ParseProjectPath(input)
+		if err != nil {
+			return
+		}
+		str := path.String()
+		if str == "" || strings.HasPrefix(str, "/") || strings.HasSuffix(str, "/") ||
+			strings.Contains(str, "//") || strings.ContainsAny(str, "\x00\\%") {
+			t.Fatalf("%q parsed to non-canonical %q", input, str)
+		}
+		for _, segment := range strings.Split(str, "/") {
+			if segment == "." || segment == ".." {
+				t.Fatalf("%q parsed to traversing %q", input, str)
+			}
+		}
+		again, err := ParseProjectPath(str)
+		if err != nil || again != path {
+			t.Fatalf("%q is not stable: %q -> %q (%v)", input, str, again, err)
+		}
+	})
+}
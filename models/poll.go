@@ -0,0 +1,51 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package models
+
+import "time"
+
+// States of a PollJob.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// PollJob is an update of the repo-metadata clone requested through poll.
+// Revisions are empty until known, times nil until reached.
+type PollJob struct {
+	ID              string     `json:"id"`
+	State           string     `json:"state"`
+	OldRevision     string     `json:"old_revision"`
+	NewRevision     string     `json:"new_revision"`
+	ChangedProjects int        `json:"changed_projects"`
+	Output          string     `json:"output"`
+	Error           string     `json:"error,omitempty"`
+	QueuedAt        time.Time  `json:"queued_at"`
+	StartedAt       *time.Time `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at"`
+}
+
+// Done returns whether the job succeeded or failed.
+func (j *PollJob) Done() bool {
+	return j.State == JobSucceeded || j.State == JobFailed
+}
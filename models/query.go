@@ -0,0 +1,41 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package models
+
+// QueryResult is the outcome of a SQL query against the projects of
+// Revision.
+type QueryResult struct {
+	Revision string          `json:"revision"`
+	Columns  []string        `json:"columns"`
+	Rows     [][]interface{} `json:"rows"`
+	// Truncated is set when there were more rows than allowed.
+	Truncated bool `json:"truncated"`
+}
+
+// QueryError is returned for statements that cannot run, be it for a
+// syntax error or because they would write.
+type QueryError struct {
+	Message string
+}
+
+func (e *QueryError) Error() string {
+	return e.Message
+}
@@ -0,0 +1,47 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package models
+
+import "time"
+
+// Stats are aggregates over the resolved projects of one revision.
+type Stats struct {
+	Revision     string    `json:"revision"`
+	RevisionTime time.Time `json:"revision_time"`
+	Projects     int       `json:"projects"`
+	// Counts by top level group and type, e.g. frameworks → project → 80.
+	Groups      map[string]map[string]int `json:"groups"`
+	HasRepo     int                       `json:"hasrepo"`
+	WithoutRepo int                       `json:"without_repo"`
+	// Of the projects with a repository, those marked (in)active.
+	ActiveRepos   int `json:"active_repos"`
+	InactiveRepos int `json:"inactive_repos"`
+	// Counts by i18n key and resolved branch, e.g. trunk_kf5 → master → 120.
+	I18n           map[string]map[string]int `json:"i18n"`
+	WithoutMembers int                       `json:"without_members"`
+}
+
+// StatsReport are the stats of the served revision and of recent revisions,
+// newest first.
+type StatsReport struct {
+	Current Stats   `json:"current"`
+	Series  []Stats `json:"series"`
+}
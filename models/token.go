@@ -0,0 +1,56 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Scopes of API tokens. ScopeAdmin grants all other scopes.
+const (
+	ScopeRead  = "read"
+	ScopePoll  = "poll"
+	ScopeAdmin = "admin"
+)
+
+// Token is an API token. Only the hash of the secret is ever stored.
+type Token struct {
+	Name   string   `json:"name" yaml:"name"`
+	Hash   string   `json:"hash" yaml:"hash"`
+	Scopes []string `json:"scopes" yaml:"scopes"`
+}
+
+// HashToken returns the hex encoded SHA-256 of secret, as stored in Hash.
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// HasScope returns whether the token grants scope.
+func (t *Token) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
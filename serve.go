@@ -0,0 +1,143 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/apis"
+	"anongit.kde.org/websites/api-projects-kde-org.git/daos"
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+	"anongit.kde.org/websites/api-projects-kde-org.git/services"
+	"anongit.kde.org/websites/api-projects-kde-org.git/tracing"
+
+	"github.com/coreos/go-systemd/activation"
+	"github.com/gin-gonic/gin"
+)
+
+// serve serves the API on the sockets passed by systemd.
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	metadata := addMetadataFlags(fs, "info")
+	rateInterval := fs.Duration("rate-interval", 100*time.Millisecond,
+		"interval in which a client regains a request, 0 disables rate limiting")
+	rateBurst := fs.Int("rate-burst", 50, "requests a client may do at once")
+	adminRateInterval := fs.Duration("admin-rate-interval", 2*time.Minute,
+		"interval in which a client regains an administrative request such as poll")
+	adminRateBurst := fs.Int("admin-rate-burst", 1,
+		"administrative requests a client may do at once")
+	tokensPath := fs.String("tokens", "",
+		"YAML file or directory of YAML files listing API tokens, without it administrative routes are unavailable")
+	privateRead := fs.Bool("private", false,
+		"require a token with the read scope for all routes")
+	traceExporter := fs.String("trace-exporter", "none",
+		"where to export traces to, one of none, otlp (configured through OTEL_EXPORTER_OTLP_* variables), stdout or file")
+	traceFile := fs.String("trace-file", "traces.json", "file the file trace exporter writes to")
+	fs.Parse(args)
+
+	logger := metadata.newLogger()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), *traceExporter, *traceFile)
+	if err != nil {
+		panic(err)
+	}
+
+	logger.Info("Ready to rumble...")
+	router := gin.New()
+	router.Use(gin.Recovery(), apis.RequestLogger(logger), apis.Tracing())
+	router.GET("/", func(c *gin.Context) {
+		c.Redirect(http.StatusMovedPermanently, "/doc")
+	})
+	router.StaticFS("/doc", http.Dir("contents-doc"))
+
+	v1 := router.Group("/v1")
+	{
+		gitDAO := metadata.newGitDAO(true, logger)
+		gitService := services.NewGitService(gitDAO)
+		// First, so that rejected requests name the revision too.
+		v1.Use(apis.CacheHeaders(gitService, daos.UpdateInterval))
+		if *tokensPath != "" {
+			tokenDAO, err := daos.NewTokenDAO(*tokensPath)
+			if err != nil {
+				panic(err)
+			}
+			v1.Use(apis.Authenticate(services.NewAuthService(tokenDAO)))
+		}
+		v1.Use(apis.RateLimiter(apis.RateLimit{Interval: *rateInterval, Burst: *rateBurst}))
+		if *privateRead {
+			v1.Use(apis.RequireScope(models.ScopeRead))
+		}
+		apis.ServeGitResource(v1, services.NewPollService(gitDAO),
+			apis.RateLimiter(apis.RateLimit{Interval: *adminRateInterval, Burst: *adminRateBurst}))
+		projectService := services.NewProjectService(gitDAO)
+		subresources := apis.NewProjectSubresources()
+		apis.ServeProjectResource(v1, projectService, subresources)
+		apis.ServeGraphQLResource(v1, projectService)
+		apis.ServeDiffResource(v1, services.NewDiffService(gitDAO))
+		apis.ServeSQLResource(v1, services.NewSQLService(daos.NewDatabaseDAO(gitDAO)))
+		apis.ServeStatsResource(v1, services.NewStatsService(gitDAO))
+		if *metadata.buildMetadata {
+			apis.ServeDependencyResource(v1, subresources, services.NewDependencyService(gitDAO))
+			apis.ServeBranchGroupResource(v1, services.NewBranchGroupService(gitDAO))
+		}
+		apis.ServeOpenAPIResource(v1, func() gin.RoutesInfo {
+			return append(router.Routes(), subresources.Routes()...)
+		})
+	}
+
+	listeners, err := activation.Listeners(true)
+	if err != nil {
+		panic(err)
+	}
+
+	// if len(listeners) != 1 {
+	// 	gracehttp.Serve()
+	// } else {
+	// grace is the only thing that seems to properly support multiple sockets,
+	// but unfortunately it cannot tell itself apart from
+	// user-systemds nor systemd-active making it shitty to deploy and shitty to
+	// test as former needs root access and latter requires testing through
+	// the actual systemd PID 1.
+	logger.Info("starting servers", "listeners", len(listeners))
+	var servers []*http.Server
+	for _, listener := range listeners {
+		server := &http.Server{Handler: router}
+		go server.Serve(listener)
+		servers = append(servers, server)
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+	logger.Info("shutting down")
+	if err = shutdownTracing(context.Background()); err != nil {
+		logger.Error("failed to flush traces", "error", err)
+	}
+	// fmt.Println("starting grace")
+	// gracehttp.SetLogger(log.New(os.Stderr, "logger: ", log.Lshortfile))
+	// 	gracehttp.Serve(servers...)
+	// }
+}
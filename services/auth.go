@@ -0,0 +1,42 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package services
+
+import (
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+)
+
+type tokenDAO interface {
+	Token(hash string) (models.Token, error)
+}
+
+type AuthService struct {
+	dao tokenDAO
+}
+
+func NewAuthService(dao tokenDAO) *AuthService {
+	return &AuthService{dao}
+}
+
+// Authenticate returns the token of secret.
+func (s *AuthService) Authenticate(secret string) (models.Token, error) {
+	return s.dao.Token(models.HashToken(secret))
+}
@@ -0,0 +1,53 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package services
+
+import (
+	"context"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+)
+
+type dependencyDAO interface {
+	Dependencies(ctx context.Context, branchGroup string, path models.ProjectPath) ([]models.ProjectPath, error)
+	Dependents(ctx context.Context, branchGroup string, path models.ProjectPath) ([]models.ProjectPath, error)
+	BuildOrder(ctx context.Context, branchGroup string, paths []models.ProjectPath) ([]models.ProjectPath, error)
+}
+
+type DependencyService struct {
+	dao dependencyDAO
+}
+
+func NewDependencyService(dao dependencyDAO) *DependencyService {
+	return &DependencyService{dao}
+}
+
+func (s *DependencyService) Dependencies(ctx context.Context, branchGroup string, path models.ProjectPath) ([]models.ProjectPath, error) {
+	return s.dao.Dependencies(ctx, branchGroup, path)
+}
+
+func (s *DependencyService) Dependents(ctx context.Context, branchGroup string, path models.ProjectPath) ([]models.ProjectPath, error) {
+	return s.dao.Dependents(ctx, branchGroup, path)
+}
+
+func (s *DependencyService) BuildOrder(ctx context.Context, branchGroup string, paths []models.ProjectPath) ([]models.ProjectPath, error) {
+	return s.dao.BuildOrder(ctx, branchGroup, paths)
+}
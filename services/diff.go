@@ -0,0 +1,43 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package services
+
+import (
+	"context"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+)
+
+type diffDAO interface {
+	Diff(ctx context.Context, from string, to string, within int) (*models.Diff, error)
+}
+
+type DiffService struct {
+	dao diffDAO
+}
+
+func NewDiffService(dao diffDAO) *DiffService {
+	return &DiffService{dao}
+}
+
+func (s *DiffService) Diff(ctx context.Context, from string, to string, within int) (*models.Diff, error) {
+	return s.dao.Diff(ctx, from, to, within)
+}
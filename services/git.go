@@ -21,15 +21,26 @@
 package services
 
 import (
+	"context"
 	"time"
 
 	"anongit.kde.org/websites/api-projects-kde-org.git/models"
 )
 
 type gitDAO interface {
-	UpdateClone() string
+	UpdateClone(ctx context.Context) (string, error)
 	Age() time.Duration
-	Get(path string) (models.Project, error)
+	Revision() string
+	LastModified() time.Time
+	Get(ctx context.Context, path models.ProjectPath) (models.Project, string, error)
+	GetMany(ctx context.Context, paths []string) (map[string]models.Project, map[string]error, string)
+	Find(ctx context.Context, id string, repopath string) ([]models.ProjectPath, error)
+	Children(ctx context.Context, path models.ProjectPath) ([]models.ProjectPath, error)
+	Overridden(path models.ProjectPath) []string
+	Redirect(ctx context.Context, path models.ProjectPath) (models.ProjectPath, bool)
+	Aliases(ctx context.Context, path models.ProjectPath) []models.ProjectPath
+	Suggest(ctx context.Context, path models.ProjectPath) []models.ProjectPath
+	Complete(ctx context.Context, query string, limit int) ([]models.Completion, error)
 }
 
 type GitService struct {
@@ -40,10 +51,18 @@ func NewGitService(dao gitDAO) *GitService {
 	return &GitService{dao}
 }
 
-func (s *GitService) UpdateClone() string {
-	return s.dao.UpdateClone()
+func (s *GitService) UpdateClone(ctx context.Context) (string, error) {
+	return s.dao.UpdateClone(ctx)
 }
 
 func (s *GitService) Age() time.Duration {
 	return s.dao.Age()
 }
+
+func (s *GitService) Revision() string {
+	return s.dao.Revision()
+}
+
+func (s *GitService) LastModified() time.Time {
+	return s.dao.LastModified()
+}
@@ -0,0 +1,164 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"sync"
+	"time"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/logging"
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+)
+
+type pollDAO interface {
+	UpdateClone(ctx context.Context) (string, error)
+	Revision() string
+	Diff(ctx context.Context, from string, to string, within int) (*models.Diff, error)
+}
+
+// Finished jobs are forgotten once there are more.
+const maxPollJobs = 64
+
+// PollService updates the clone in the background. Jobs run one at a time.
+// Polls while a job is queued join that job. Polls while a job is running
+// queue a new one, the running pull may have started before whatever the
+// poller wants to see was pushed.
+type PollService struct {
+	dao   pollDAO
+	mutex sync.Mutex
+	jobs  map[string]*models.PollJob
+	// IDs of the jobs in order of creation.
+	order   []string
+	queued  *models.PollJob
+	working bool
+}
+
+func NewPollService(dao pollDAO) *PollService {
+	return &PollService{dao: dao, jobs: map[string]*models.PollJob{}}
+}
+
+func newJobID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Poll queues an update unless one is queued already and returns the job.
+// The job outlives ctx but keeps its values, e.g. the logger.
+func (s *PollService) Poll(ctx context.Context) models.PollJob {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.queued != nil {
+		return *s.queued
+	}
+	job := &models.PollJob{ID: newJobID(), State: models.JobQueued, QueuedAt: time.Now()}
+	s.queued = job
+	s.jobs[job.ID] = job
+	s.order = append(s.order, job.ID)
+	s.forget()
+	if !s.working {
+		s.working = true
+		go s.work(context.WithoutCancel(ctx))
+	}
+	return *job
+}
+
+// PollJob returns the job with id.
+func (s *PollService) PollJob(id string) (models.PollJob, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return models.PollJob{}, models.ErrUnknownJob
+	}
+	return *job, nil
+}
+
+// forget drops the oldest finished jobs beyond maxPollJobs.
+func (s *PollService) forget() {
+	for i := 0; len(s.order) > maxPollJobs && i < len(s.order); {
+		if !s.jobs[s.order[i]].Done() {
+			i++
+			continue
+		}
+		delete(s.jobs, s.order[i])
+		s.order = append(s.order[:i], s.order[i+1:]...)
+	}
+}
+
+// work runs queued jobs until there are none left.
+func (s *PollService) work(ctx context.Context) {
+	for {
+		s.mutex.Lock()
+		job := s.queued
+		if job == nil {
+			s.working = false
+			s.mutex.Unlock()
+			return
+		}
+		s.queued = nil
+		now := time.Now()
+		job.State = models.JobRunning
+		job.StartedAt = &now
+		s.mutex.Unlock()
+
+		result := s.run(ctx, job.ID)
+
+		s.mutex.Lock()
+		now = time.Now()
+		result.ID, result.QueuedAt, result.StartedAt, result.FinishedAt = job.ID, job.QueuedAt, job.StartedAt, &now
+		*job = result
+		s.mutex.Unlock()
+	}
+}
+
+// run updates the clone.
+func (s *PollService) run(ctx context.Context, id string) (job models.PollJob) {
+	log := logging.FromContext(ctx, slog.Default()).With("job", id)
+	job.OldRevision = s.dao.Revision()
+	output, err := s.dao.UpdateClone(ctx)
+	job.Output = output
+	job.NewRevision = s.dao.Revision()
+	if err != nil {
+		log.Error("poll failed", "error", err)
+		job.State = models.JobFailed
+		job.Error = err.Error()
+		return job
+	}
+
+	job.State = models.JobSucceeded
+	if job.OldRevision != "" && job.NewRevision != job.OldRevision {
+		diff, err := s.dao.Diff(ctx, job.OldRevision, job.NewRevision, 0)
+		if err != nil {
+			log.Warn("cannot count changed projects", "error", err)
+		} else {
+			job.ChangedProjects = diff.Changes()
+		}
+	}
+	log.Info("polled", "from", job.OldRevision, "to", job.NewRevision, "changed", job.ChangedProjects)
+	return job
+}
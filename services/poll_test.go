@@ -0,0 +1,114 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"anongit.kde.org/websites/api-projects-kde-org.git/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test Double
+type pollDAODouble struct {
+	started  chan struct{}
+	release  chan string
+	revision string
+}
+
+func (dao *pollDAODouble) UpdateClone(ctx context.Context) (string, error) {
+	dao.started <- struct{}{}
+	output := <-dao.release
+	if output == "" {
+		return "fatal: unable to access", errors.New("pull failed")
+	}
+	dao.revision = output
+	return output, nil
+}
+
+func (dao *pollDAODouble) Revision() string {
+	return dao.revision
+}
+
+func (dao *pollDAODouble) Diff(ctx context.Context, from string, to string, within int) (*models.Diff, error) {
+	return &models.Diff{From: from, To: to, Added: []models.ProjectPath{"a", "b"}}, nil
+}
+
+func waitForJob(t *testing.T, s *PollService, id string) models.PollJob {
+	for i := 0; i < 1000; i++ {
+		job, err := s.PollJob(id)
+		assert.NoError(t, err)
+		if job.Done() {
+			return job
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return models.PollJob{}
+}
+
+func TestPoll(t *testing.T) {
+	dao := &pollDAODouble{started: make(chan struct{}), release: make(chan string), revision: "rev1"}
+	s := NewPollService(dao)
+
+	first := s.Poll(context.Background())
+	assert.Equal(t, models.JobQueued, first.State)
+	<-dao.started
+	running, _ := s.PollJob(first.ID)
+	assert.Equal(t, models.JobRunning, running.State)
+	assert.NotNil(t, running.StartedAt)
+
+	// Running jobs are not joined, queued ones are.
+	second := s.Poll(context.Background())
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.Equal(t, second.ID, s.Poll(context.Background()).ID)
+
+	dao.release <- "rev2"
+	job := waitForJob(t, s, first.ID)
+	assert.Equal(t, models.JobSucceeded, job.State)
+	assert.Equal(t, "rev1", job.OldRevision)
+	assert.Equal(t, "rev2", job.NewRevision)
+	assert.Equal(t, 2, job.ChangedProjects)
+	assert.Equal(t, "rev2", job.Output)
+	assert.NotNil(t, job.FinishedAt)
+
+	<-dao.started
+	dao.release <- "rev2"
+	job = waitForJob(t, s, second.ID)
+	assert.Equal(t, models.JobSucceeded, job.State)
+	assert.Equal(t, 0, job.ChangedProjects)
+
+	// Failures fail the job, not the service.
+	third := s.Poll(context.Background())
+	<-dao.started
+	dao.release <- ""
+	job = waitForJob(t, s, third.ID)
+	assert.Equal(t, models.JobFailed, job.State)
+	assert.Equal(t, "pull failed", job.Error)
+	assert.Equal(t, "fatal: unable to access", job.Output)
+
+	_, err := s.PollJob("nope")
+	assert.Equal(t, models.ErrUnknownJob, err)
+}
@@ -21,8 +21,7 @@
 package services
 
 import (
-	"os"
-	"path/filepath"
+	"context"
 
 	"anongit.kde.org/websites/api-projects-kde-org.git/models"
 )
@@ -35,42 +34,38 @@ func NewProjectService(dao gitDAO) *ProjectService {
 	return &ProjectService{dao}
 }
 
-func (s *ProjectService) Get(path string) (models.Project, error) {
-	return s.dao.Get(path)
+func (s *ProjectService) Get(ctx context.Context, path models.ProjectPath) (models.Project, string, error) {
+	return s.dao.Get(ctx, path)
 }
 
-func isProject(path string) bool {
-	_, err := os.Stat(path + "/metadata.yaml")
-	return err == nil
+func (s *ProjectService) GetMany(ctx context.Context, paths []string) (map[string]models.Project, map[string]error, string) {
+	return s.dao.GetMany(ctx, paths)
 }
 
-func (s *ProjectService) Find(id string, repopath string) ([]string, error) {
-	matches := []string{}
-	// TODO: should live in the DAO in some capacity
-	filepath.Walk("repo-metadata/projects", func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			panic(err)
-		}
-		if info.IsDir() && isProject(path) {
-			if len(id) != 0 && info.Name() != id {
-				return nil // Doesn't match id constraint
-			}
-			rel, err := filepath.Rel("repo-metadata/projects", path)
-			if err != nil {
-				panic(err)
-			}
-			if len(repopath) != 0 {
-				model, err := s.Get(rel)
-				if err != nil {
-					panic(err)
-				}
-				if model["repopath"] != repopath {
-					return nil // doesn't match repopath constraint
-				}
-			}
-			matches = append(matches, rel)
-		}
-		return nil
-	})
-	return matches, nil
+func (s *ProjectService) Find(ctx context.Context, id string, repopath string) ([]models.ProjectPath, error) {
+	return s.dao.Find(ctx, id, repopath)
+}
+
+func (s *ProjectService) Overridden(path models.ProjectPath) []string {
+	return s.dao.Overridden(path)
+}
+
+func (s *ProjectService) Children(ctx context.Context, path models.ProjectPath) ([]models.ProjectPath, error) {
+	return s.dao.Children(ctx, path)
+}
+
+func (s *ProjectService) Redirect(ctx context.Context, path models.ProjectPath) (models.ProjectPath, bool) {
+	return s.dao.Redirect(ctx, path)
+}
+
+func (s *ProjectService) Aliases(ctx context.Context, path models.ProjectPath) []models.ProjectPath {
+	return s.dao.Aliases(ctx, path)
+}
+
+func (s *ProjectService) Suggest(ctx context.Context, path models.ProjectPath) []models.ProjectPath {
+	return s.dao.Suggest(ctx, path)
+}
+
+func (s *ProjectService) Complete(ctx context.Context, query string, limit int) ([]models.Completion, error) {
+	return s.dao.Complete(ctx, query, limit)
 }
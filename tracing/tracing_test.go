@@ -0,0 +1,59 @@
+/*
+	Copyright © 2017 Harald Sitter <sitter@kde.org>
+
+	This program is free software; you can redistribute it and/or
+	modify it under the terms of the GNU General Public License as
+	published by the Free Software Foundation; either version 3 of
+	the License or any later version accepted by the membership of
+	KDE e.V. (or its successor approved by the membership of KDE
+	e.V.), which shall act as a proxy defined in Section 14 of
+	version 3 of the license.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetupFile(t *testing.T) {
+	tmpdir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmpdir)
+	file := filepath.Join(tmpdir, "spans.json")
+
+	shutdown, err := Setup(context.Background(), "file", file)
+	assert.NoError(t, err)
+	_, span := Tracer().Start(context.Background(), "test span")
+	span.End()
+	assert.NoError(t, shutdown(context.Background()))
+
+	data, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &record))
+	assert.Equal(t, "test span", record["Name"])
+}
+
+func TestSetupUnknown(t *testing.T) {
+	_, err := Setup(context.Background(), "carrier-pigeon", "")
+	assert.Error(t, err)
+
+	shutdown, err := Setup(context.Background(), "none", "")
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}